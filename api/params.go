@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/task"
+)
+
+// 通过 API 发起测速时可指定的参数，名称与配置文件一致，未指定的使用默认配置
+// 出于安全考虑不支持指定 IP 段数据文件，只能通过 ip 直接指定 IP 段
+type params struct {
+	Threads             *int    `json:"threads"`
+	PingTimes           *int    `json:"ping_times"`
+	DownloadCount       *int    `json:"download_count"`
+	DownloadTime        *int    `json:"download_time"` // 秒
+	DownloadRoutines    *int    `json:"download_routines"`
+	TestCapacity        *bool   `json:"test_capacity"`
+	DownloadConnections *int    `json:"download_connections"`
+	UploadURL           *string `json:"upload_url"`
+	UploadSize          *int    `json:"upload_size"` // MB
+	SortByUpload        *bool   `json:"sort_by_upload"`
+	Port                *int    `json:"port"`
+	URL                 *string `json:"url"`
+
+	Httping        *bool     `json:"httping"`
+	HttpingCode    *codeList `json:"httping_code"`
+	HttpingHeaders []string  `json:"httping_headers"` // Name: value
+	HttpingBody    *string   `json:"httping_body"`
+	ICMP           *bool     `json:"icmp"`
+	TLSPing        *bool     `json:"tls_ping"`
+	HTTP3          *bool     `json:"http3"`
+	SNI            *string   `json:"sni"`
+	Host           *string   `json:"host"`
+	UserAgent      *string   `json:"user_agent"`
+	Headers        []string  `json:"headers"` // Name: value
+	Insecure       *bool     `json:"insecure"`
+	CFColo         *string   `json:"cfcolo"`
+	CFCountry      *string   `json:"cfcountry"`
+	CFContinent    *string   `json:"cfcontinent"`
+	CFColoExclude  *string   `json:"cfcolo_exclude"`
+	ColoTrace      *bool     `json:"colo_trace"`
+	Trace          *bool     `json:"trace"`
+
+	MaxDelay       *int     `json:"max_delay"` // 延迟单位均为 ms
+	MinDelay       *int     `json:"min_delay"`
+	MaxLossRate    *float64 `json:"max_loss_rate"`
+	MaxPeakDelay   *int     `json:"max_peak_delay"`
+	MaxMedianDelay *int     `json:"max_median_delay"`
+	MaxP95Delay    *int     `json:"max_p95_delay"`
+	MaxJitter      *int     `json:"max_jitter"`
+	MaxConnect     *int     `json:"max_connect_delay"`
+	MaxTLS         *int     `json:"max_tls_delay"`
+	MaxTTFB        *int     `json:"max_ttfb"`
+	Sort           *string  `json:"sort"`
+	Score          *string  `json:"score"`
+	MinSpeed       *float64 `json:"min_speed"`
+	MinUploadSpeed *float64 `json:"min_upload_speed"`
+
+	IP              *string `json:"ip"`
+	All4            *bool   `json:"all4"`
+	IPv4Num         *string `json:"ipv4_num"` // 2^n±m
+	IPv6Num         *string `json:"ipv6_num"`
+	DisableDownload *bool   `json:"disable_download"`
+}
+
+func (p *params) apply(o *task.Options) error {
+	setInt(&o.Routines, p.Threads)
+	setInt(&o.PingTimes, p.PingTimes)
+	setInt(&o.TestCount, p.DownloadCount)
+	if p.DownloadTime != nil {
+		o.Timeout = time.Duration(*p.DownloadTime) * time.Second
+	}
+	setInt(&o.DownloadRoutines, p.DownloadRoutines)
+	setBool(&o.TestCapacity, p.TestCapacity)
+	setInt(&o.Connections, p.DownloadConnections)
+	setString(&o.UploadURL, p.UploadURL)
+	if p.UploadSize != nil {
+		o.UploadSize = int64(*p.UploadSize) * 1024 * 1024
+	}
+	setBool(&o.SortByUpload, p.SortByUpload)
+	setInt(&o.TCPPort, p.Port)
+	setString(&o.URL, p.URL)
+
+	setBool(&o.Httping, p.Httping)
+	if p.HttpingCode != nil {
+		o.HttpingStatusCode = string(*p.HttpingCode)
+	}
+	if p.HttpingHeaders != nil {
+		o.HttpingHeaders = make(http.Header)
+		for _, line := range p.HttpingHeaders {
+			if err := task.AddHeader(o.HttpingHeaders, line); err != nil {
+				return err
+			}
+		}
+	}
+	setString(&o.HttpingBody, p.HttpingBody)
+	setBool(&o.ICMP, p.ICMP)
+	setBool(&o.TLSPing, p.TLSPing)
+	setBool(&o.HTTP3, p.HTTP3)
+	setString(&o.SNI, p.SNI)
+	setString(&o.Host, p.Host)
+	setString(&o.UserAgent, p.UserAgent)
+	if p.Headers != nil { // 替换默认配置中的请求头
+		o.Headers = make(http.Header)
+		for _, line := range p.Headers {
+			if err := task.AddHeader(o.Headers, line); err != nil {
+				return err
+			}
+		}
+	}
+	setBool(&o.Insecure, p.Insecure)
+	setString(&o.HttpingCFColo, p.CFColo)
+	setString(&o.ColoCountries, p.CFCountry)
+	setString(&o.ColoContinents, p.CFContinent)
+	setString(&o.ColoExclude, p.CFColoExclude)
+	setBool(&o.ColoTrace, p.ColoTrace)
+	setBool(&o.Trace, p.Trace)
+
+	setMs(&o.Filter.MaxDelay, p.MaxDelay)
+	setMs(&o.Filter.MinDelay, p.MinDelay)
+	if p.MaxLossRate != nil {
+		o.Filter.MaxLossRate = float32(*p.MaxLossRate)
+	}
+	setMs(&o.Filter.MaxPeakDelay, p.MaxPeakDelay)
+	setMs(&o.Filter.MaxMedianDelay, p.MaxMedianDelay)
+	setMs(&o.Filter.MaxP95Delay, p.MaxP95Delay)
+	setMs(&o.Filter.MaxJitter, p.MaxJitter)
+	setMs(&o.Filter.MaxConnectDelay, p.MaxConnect)
+	setMs(&o.Filter.MaxTLSDelay, p.MaxTLS)
+	setMs(&o.Filter.MaxTTFB, p.MaxTTFB)
+	setString(&o.SortBy, p.Sort)
+	setString(&o.Score, p.Score)
+	if p.MinSpeed != nil {
+		o.MinSpeed = *p.MinSpeed
+	}
+	if p.MinUploadSpeed != nil {
+		o.MinUploadSpeed = *p.MinUploadSpeed
+	}
+
+	setString(&o.IPText, p.IP)
+	setBool(&o.TestAll4, p.All4)
+	if p.IPv4Num != nil {
+		o.IPv4TestNum = task.ParseTestNum(*p.IPv4Num, true)
+	}
+	if p.IPv6Num != nil {
+		o.IPv6TestNum = task.ParseTestNum(*p.IPv6Num, false)
+	}
+	setBool(&o.Disable, p.DisableDownload)
+	return nil
+}
+
+// 有效状态码，兼容旧版的单个数字（如 200）及字符串形式的列表（如 "200,300-399"）
+type codeList string
+
+func (c *codeList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = codeList(s)
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("httping_code 应为数字或字符串")
+	}
+	*c = codeList(strconv.Itoa(n))
+	return nil
+}
+
+func setInt(dst, v *int) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func setString(dst, v *string) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func setBool(dst, v *bool) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func setMs(dst *time.Duration, v *int) {
+	if v != nil {
+		*dst = time.Duration(*v) * time.Millisecond
+	}
+}
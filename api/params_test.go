@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/task"
+)
+
+// httping_code 兼容旧版的单个数字及新的字符串形式
+func TestCodeListUnmarshal(t *testing.T) {
+	tests := []struct {
+		body string
+		code string
+		err  bool // 解析参数时报错
+		bad  bool // 检查测速配置时报错
+	}{
+		{`{}`, "", false, false},
+		{`{"httping_code": null}`, "", false, false},
+		{`{"httping_code": 200}`, "200", false, false},
+		{`{"httping_code": 0}`, "0", false, false},
+		{`{"httping_code": "200"}`, "200", false, false},
+		{`{"httping_code": "200,300-399"}`, "200,300-399", false, false},
+		{`{"httping_code": ""}`, "", false, false},
+		{`{"httping_code": 99}`, "99", false, true},
+		{`{"httping_code": "2xx"}`, "2xx", false, true},
+		{`{"httping_code": 200.5}`, "", true, false},
+		{`{"httping_code": true}`, "", true, false},
+		{`{"httping_code": [200, 301]}`, "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			var p params
+			err := json.Unmarshal([]byte(tt.body), &p)
+			if tt.err {
+				if err == nil {
+					t.Errorf("应报错，实际为 %v", p.HttpingCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			o := task.DefaultOptions()
+			o.HttpingStatusCode = ""
+			if err := p.apply(&o); err != nil {
+				t.Fatal(err)
+			}
+			if o.HttpingStatusCode != tt.code {
+				t.Errorf("状态码 = %q，应为 %q", o.HttpingStatusCode, tt.code)
+			}
+			if err := task.CheckOptions(o); (err != nil) != tt.bad {
+				t.Errorf("检查测速配置的结果 = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/task"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const (
+	defaultHistorySize = 20
+	shutdownTimeout    = 5 * time.Second
+	maxBodySize        = 1 << 16
+)
+
+// 测速状态
+const (
+	StatusRunning  = "running"
+	StatusDone     = "done"
+	StatusFailed   = "failed"
+	StatusCanceled = "canceled"
+)
+
+// 测速来源
+const (
+	SourceAPI    = "api"
+	SourceDaemon = "daemon"
+)
+
+var errBusy = errors.New("已有测速正在进行")
+
+// 一次测速的记录
+type Run struct {
+	ID        int               `json:"id"`
+	Source    string            `json:"source"`
+	Status    string            `json:"status"`
+	StartTime time.Time         `json:"start_time"`
+	EndTime   *time.Time        `json:"end_time,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Progress  task.Progress     `json:"progress"`
+	Count     int               `json:"count"` // 测速结果 IP 数量
+	Results   []*utils.IPRecord `json:"results,omitempty"`
+
+	tester *task.Tester
+	cancel context.CancelFunc
+}
+
+// 本地 HTTP API：发起测速、查询进度、获取最近的测速结果及历史记录
+type Server struct {
+	Base        task.Options // 通过 API 发起测速时的默认配置，请求中的参数在此基础上修改
+	HistorySize int          // 保留的历史记录数量，默认 20
+
+	// 通过 API 发起的测速开始及结束（未被取消）时调用，如记录 Prometheus 指标，可为 nil
+	OnStart  func(tester *task.Tester)
+	OnFinish func(tester *task.Tester, data utils.DownloadSpeedSet, start, end time.Time, err error)
+
+	mu      sync.Mutex
+	nextID  int
+	history []*Run // 按开始时间排序
+	latest  *Run   // 最近一次成功的测速
+}
+
+// 监听指定地址，ctx 取消时关闭服务
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: s.Handler()}
+	go func() {
+		<-ctx.Done()
+		s.cancelAll()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// 路由：
+//
+//	GET    /api/progress   当前（或最近一次）测速的进度
+//	GET    /api/results    最近一次成功的测速结果
+//	GET    /api/runs       历史记录（不含测速结果）
+//	POST   /api/runs       发起测速，请求体为 JSON 格式的参数（可为空）
+//	GET    /api/runs/{id}  单次测速的记录及结果
+//	DELETE /api/runs/{id}  取消正在进行的测速
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/progress", s.handleProgress)
+	mux.HandleFunc("/api/results", s.handleResults)
+	mux.HandleFunc("/api/runs", s.handleRuns)
+	mux.HandleFunc("/api/runs/", s.handleRun)
+	return mux
+}
+
+// 记录一次由其他方式（如常驻运行）发起的测速，返回的函数需在测速结束时调用
+func (s *Server) Track(source string, tester *task.Tester) func(utils.DownloadSpeedSet, error) {
+	s.mu.Lock()
+	run := s.add(source, tester)
+	s.mu.Unlock()
+	return func(data utils.DownloadSpeedSet, err error) {
+		s.finish(run, data, err, err == context.Canceled)
+	}
+}
+
+// 以指定配置发起测速，已有测速正在进行时返回 errBusy，配置有误时返回对应的错误
+func (s *Server) Start(opts task.Options) (*Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running() != nil {
+		return nil, errBusy
+	}
+	opts.Quiet = true
+	tester, err := task.NewTester(opts)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	run := s.add(SourceAPI, tester)
+	run.cancel = cancel
+	if s.OnStart != nil {
+		s.OnStart(tester)
+	}
+	go func() {
+		defer cancel()
+		data, err := tester.Run(ctx)
+		canceled := ctx.Err() != nil
+		s.finish(run, data, err, canceled)
+		if s.OnFinish != nil && !canceled {
+			s.OnFinish(tester, data, run.StartTime, time.Now(), err)
+		}
+	}()
+	snapshot := s.snapshot(run, false)
+	return &snapshot, nil
+}
+
+func (s *Server) add(source string, tester *task.Tester) *Run {
+	s.nextID++
+	run := &Run{ID: s.nextID, Source: source, Status: StatusRunning, StartTime: time.Now(), tester: tester}
+	s.history = append(s.history, run)
+	size := s.HistorySize
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	// 超出数量时从最早的记录起删除，正在进行的测速不删除，以免无法查询及取消
+	excess := len(s.history) - size
+	kept := s.history[:0]
+	for _, r := range s.history {
+		if excess > 0 && r.Status != StatusRunning {
+			excess--
+			continue
+		}
+		kept = append(kept, r)
+	}
+	s.history = kept
+	return run
+}
+
+func (s *Server) finish(run *Run, data utils.DownloadSpeedSet, err error, canceled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	run.EndTime = &now
+	run.Progress = run.tester.Progress()
+	run.tester, run.cancel = nil, nil
+	switch {
+	case canceled:
+		run.Status = StatusCanceled
+	case err != nil:
+		run.Status, run.Error = StatusFailed, err.Error()
+	default:
+		run.Status = StatusDone
+		run.Count = len(data)
+		run.Results = make([]*utils.IPRecord, 0, len(data))
+		for i := range data {
+			run.Results = append(run.Results, data[i].ToRecord())
+		}
+		if len(data) > 0 {
+			s.latest = run
+		}
+	}
+}
+
+// 正在进行的测速
+func (s *Server) running() *Run {
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if s.history[i].Status == StatusRunning {
+			return s.history[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) find(id int) *Run {
+	for _, run := range s.history {
+		if run.ID == id {
+			return run
+		}
+	}
+	return nil
+}
+
+func (s *Server) cancelAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.history {
+		if run.cancel != nil {
+			run.cancel()
+		}
+	}
+}
+
+// 复制一份用于输出，正在进行的测速填充实时进度
+func (s *Server) snapshot(run *Run, withResults bool) Run {
+	r := *run
+	if run.tester != nil {
+		r.Progress = run.tester.Progress()
+	}
+	if !withResults {
+		r.Results = nil
+	}
+	return r
+}
+
+func (s *Server) handleProgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "不支持的请求方法")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run := s.running()
+	if run == nil && len(s.history) > 0 {
+		run = s.history[len(s.history)-1]
+	}
+	if run == nil {
+		writeError(w, http.StatusNotFound, "尚未进行测速")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.snapshot(run, false))
+}
+
+func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "不支持的请求方法")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latest == nil {
+		writeError(w, http.StatusNotFound, "暂无测速结果")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.snapshot(s.latest, true))
+}
+
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		runs := make([]Run, 0, len(s.history))
+		for i := len(s.history) - 1; i >= 0; i-- { // 最近的在前
+			runs = append(runs, s.snapshot(s.history[i], false))
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, runs)
+	case http.MethodPost:
+		opts := s.Base
+		if err := decodeParams(r.Body, &opts); err != nil {
+			writeError(w, http.StatusBadRequest, "参数有误："+err.Error())
+			return
+		}
+		run, err := s.Start(opts)
+		if err == errBusy {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "参数有误："+err.Error())
+			return
+		}
+		writeJSON(w, http.StatusAccepted, run)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "不支持的请求方法")
+	}
+}
+
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/runs/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "测速记录不存在")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run := s.find(id)
+	if run == nil {
+		writeError(w, http.StatusNotFound, "测速记录不存在")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.snapshot(run, true))
+	case http.MethodDelete:
+		if run.cancel == nil {
+			writeError(w, http.StatusConflict, "该测速不在进行中或无法取消")
+			return
+		}
+		run.cancel()
+		writeJSON(w, http.StatusAccepted, s.snapshot(run, false))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "不支持的请求方法")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// 请求体为空时使用默认配置
+func decodeParams(body io.Reader, opts *task.Options) error {
+	content, err := io.ReadAll(io.LimitReader(body, maxBodySize))
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil
+	}
+	var p params
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return err
+	}
+	if err := p.apply(opts); err != nil {
+		return err
+	}
+	return task.CheckOptions(*opts)
+}
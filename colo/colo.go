@@ -0,0 +1,73 @@
+// 内置的 Cloudflare 数据中心位置表（机场三字码 -> 城市/国家/大洲），用于按国家、大洲筛选及显示位置
+package colo
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+// 大洲代码
+const (
+	Africa       = "AF"
+	Asia         = "AS" // 含中东
+	Europe       = "EU"
+	NorthAmerica = "NA" // 含中美洲及加勒比地区
+	SouthAmerica = "SA"
+	Oceania      = "OC"
+)
+
+var Continents = []string{Africa, Asia, Europe, NorthAmerica, SouthAmerica, Oceania}
+
+//go:embed colos.csv
+var data string
+
+var (
+	once  sync.Once
+	table map[string]Location
+)
+
+// 数据中心所在位置
+type Location struct {
+	City      string
+	Country   string // ISO 3166-1 两位代码
+	Continent string // 大洲代码
+}
+
+// 如 Tokyo, JP
+func (l Location) String() string {
+	return l.City + ", " + l.Country
+}
+
+// 每行格式为 三字码,城市,国家,大洲，# 开头为注释
+func parse() {
+	table = make(map[string]Location)
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 4 {
+			continue
+		}
+		table[fields[0]] = Location{City: fields[1], Country: fields[2], Continent: fields[3]}
+	}
+}
+
+// 查找数据中心（机场三字码，不区分大小写）的位置
+func Lookup(iata string) (Location, bool) {
+	once.Do(parse)
+	l, ok := table[strings.ToUpper(iata)]
+	return l, ok
+}
+
+// 是否为有效的大洲代码
+func IsContinent(code string) bool {
+	for _, c := range Continents {
+		if strings.EqualFold(c, code) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/ddns"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置文件中的配置项与命令行参数的对应关系，分组内的配置项以 分组.名称 表示
+var configKeys = []struct{ key, flag string }{
+	{"threads", "n"},
+	{"ping_times", "t"},
+	{"download_count", "dn"},
+	{"download_time", "dt"},
+	{"download_routines", "dc"},
+	{"test_capacity", "dcap"},
+	{"download_connections", "dconn"},
+	{"upload_url", "uurl"},
+	{"upload_size", "usize"},
+	{"min_upload_speed", "usl"},
+	{"sort_by_upload", "usort"},
+	{"port", "tp"},
+	{"url", "url"},
+
+	{"httping", "httping"},
+	{"httping_code", "httping-code"},
+	{"httping_headers", "httping-header"},
+	{"httping_body", "httping-body"},
+	{"icmp", "icmp"},
+	{"tls_ping", "tlsping"},
+	{"http3", "http3"},
+	{"sni", "sni"},
+	{"host", "host"},
+	{"user_agent", "ua"},
+	{"headers", "header"},
+	{"insecure", "insecure"},
+	{"cfcolo", "cfcolo"},
+	{"cfcountry", "cfcountry"},
+	{"cfcontinent", "cfcontinent"},
+	{"cfcolo_exclude", "cfcolo-exclude"},
+	{"colo_trace", "colo-trace"},
+	{"trace", "trace"},
+
+	{"max_delay", "tl"},
+	{"min_delay", "tll"},
+	{"max_loss_rate", "tlr"},
+	{"max_peak_delay", "tmax"},
+	{"max_median_delay", "tmed"},
+	{"max_p95_delay", "tp95"},
+	{"max_jitter", "tj"},
+	{"max_connect_delay", "tconn"},
+	{"max_tls_delay", "ttls"},
+	{"max_ttfb", "tttfb"},
+	{"sort", "sort"},
+	{"score", "score"},
+	{"min_speed", "sl"},
+
+	{"print_num", "p"},
+	{"ip_file", "f"},
+	{"ip", "ip"},
+	{"output", "o"},
+	{"output_format", "of"},
+
+	{"disable_download", "dd"},
+	{"all4", "all4"},
+	{"many4", "many4"},
+	{"some6", "some6"},
+	{"many6", "many6"},
+	{"lots6", "lots6"},
+	{"more6", "more6"},
+	{"ipv4_num", "v4"},
+	{"ipv6_num", "v6"},
+
+	{"cloudflare.api", "cf-api"},
+	{"cloudflare.zone", "cf-zone"},
+	{"cloudflare.name", "cf-name"},
+	{"cloudflare.token", "cf-token"},
+	{"cloudflare.email", "cf-email"},
+	{"cloudflare.key", "cf-key"},
+	{"cloudflare.num", "cf-num"},
+	{"cloudflare.ttl", "cf-ttl"},
+	{"cloudflare.proxied", "cf-proxied"},
+
+	{"dnspod.api", "dp-api"},
+	{"dnspod.domain", "dp-domain"},
+	{"dnspod.sub", "dp-sub"},
+	{"dnspod.token", "dp-token"},
+	{"dnspod.line", "dp-line"},
+	{"dnspod.num", "dp-num"},
+	{"dnspod.ttl", "dp-ttl"},
+
+	{"hosts.name", "hosts"},
+	{"hosts.file", "hosts-file"},
+	{"hosts.num", "hosts-num"},
+
+	{"daemon.interval", "interval"},
+	{"daemon.cron", "cron"},
+	{"daemon.hysteresis", "hysteresis"},
+
+	{"api.listen", "api"},
+
+	{"metrics.listen", "metrics"},
+	{"metrics.push", "metrics-push"},
+	{"metrics.job", "metrics-job"},
+
+	{"history.dir", "history"},
+	{"history.keep", "history-keep"},
+}
+
+// 可重复指定的命令行参数，配置文件中以列表表示，每一项分别设置（而不是以英文逗号连接）
+var repeatableKeys = map[string]bool{
+	"headers":         true,
+	"httping_headers": true,
+}
+
+// 配置文件中 dns 列表的服务商，每项需以 provider 指定服务商名称，其余为该服务商的配置项
+const configDNSKey = "dns"
+
+// 配置文件格式
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return "toml"
+	case ".json":
+		return "json"
+	}
+	return "yaml"
+}
+
+// 读取配置文件，fs 中未指定的参数以配置文件中的值为准，返回配置文件中的 dns 服务商列表
+func loadConfig(fs *flag.FlagSet, path string) ([]ddns.Options, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]interface{})
+	switch configFormat(path) {
+	case "toml":
+		err = toml.Unmarshal(content, &raw)
+	case "json":
+		err = json.Unmarshal(content, &raw)
+	default:
+		err = yaml.Unmarshal(content, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件失败：%v", err)
+	}
+
+	flagNames := make(map[string]string, len(configKeys))
+	for _, k := range configKeys {
+		flagNames[k.key] = k.flag
+	}
+	explicit := make(map[string]bool) // 命令行中指定了的参数
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	values, dnsList, err := flattenConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+	for key, list := range values {
+		name, ok := flagNames[key]
+		if !ok {
+			return nil, fmt.Errorf("未知的配置项 [%s]", key)
+		}
+		if explicit[name] {
+			continue
+		}
+		for _, value := range list {
+			if err := fs.Set(name, value); err != nil {
+				return nil, fmt.Errorf("配置项 [%s] 有误：%v", key, err)
+			}
+		}
+	}
+	return dnsList, nil
+}
+
+// 将配置展开为 分组.名称 -> 值（可重复指定的参数为多个值），并单独取出 dns 服务商列表
+func flattenConfig(raw map[string]interface{}) (values map[string][]string, dnsList []ddns.Options, err error) {
+	values = make(map[string][]string)
+	for key, value := range raw {
+		if key == configDNSKey {
+			if dnsList, err = configDNSList(value); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for sub, subValue := range v {
+				values[key+"."+sub] = []string{configString(subValue)}
+			}
+		default:
+			values[key] = configValues(key, v)
+		}
+	}
+	return
+}
+
+func configDNSList(value interface{}) ([]ddns.Options, error) {
+	var items []map[string]interface{}
+	switch v := value.(type) {
+	case []map[string]interface{}: // TOML 的 [[dns]]
+		items = v
+	case []interface{}:
+		for _, item := range v {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("配置项 [%s] 的每一项都应为键值对", configDNSKey)
+			}
+			items = append(items, m)
+		}
+	default:
+		return nil, fmt.Errorf("配置项 [%s] 应为列表", configDNSKey)
+	}
+	list := make([]ddns.Options, 0, len(items))
+	for _, item := range items {
+		opts := make(ddns.Options, len(item))
+		for k, v := range item {
+			opts[k] = configString(v)
+		}
+		if opts.String("provider") == "" {
+			return nil, fmt.Errorf("配置项 [%s] 的每一项都需指定 provider", configDNSKey)
+		}
+		list = append(list, opts)
+	}
+	return list, nil
+}
+
+func configValues(key string, value interface{}) []string {
+	list, ok := value.([]interface{})
+	if !ok || !repeatableKeys[key] {
+		return []string{configString(value)}
+	}
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		values = append(values, configString(item))
+	}
+	return values
+}
+
+// 配置值转为命令行参数的字符串形式，列表以英文逗号连接
+func configString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64: // JSON 中的数字均为 float64，避免输出为科学计数法
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, configString(item))
+		}
+		return strings.Join(list, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// 输出合并了配置文件与命令行参数后的实际配置
+func dumpConfig(fs *flag.FlagSet, w io.Writer, format string, dnsList []ddns.Options) error {
+	out := make(map[string]interface{})
+	for _, k := range configKeys {
+		value := fs.Lookup(k.flag).Value.(flag.Getter).Get()
+		if d, ok := value.(time.Duration); ok { // 以 30m 这样的形式输出
+			value = d.String()
+		}
+		if i := strings.IndexByte(k.key, '.'); i > 0 {
+			section, ok := out[k.key[:i]].(map[string]interface{})
+			if !ok {
+				section = make(map[string]interface{})
+				out[k.key[:i]] = section
+			}
+			section[k.key[i+1:]] = value
+			continue
+		}
+		out[k.key] = value
+	}
+	if len(dnsList) > 0 {
+		out[configDNSKey] = dnsList
+	}
+
+	switch strings.ToLower(format) {
+	case "toml":
+		return toml.NewEncoder(w).Encode(out)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "yaml", "yml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		return enc.Encode(out)
+	}
+	return fmt.Errorf("不支持的配置格式 [%s]，可选：yaml、toml、json", format)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/ddns"
+)
+
+const testYAMLConfig = `threads: 500
+max_delay: 300
+url: https://example.com/file
+headers:
+  - "X-Test: a"
+  - "X-Other: b"
+cloudflare:
+  zone: abc
+  name: [a.example.com, b.example.com]
+dns:
+  - provider: alidns
+    domain: example.com
+    sub: [www, cdn]
+  - provider: rfc2136
+    server: 127.0.0.1:53
+    ttl: 60
+`
+
+const testTOMLConfig = `threads = 500
+max_delay = 300
+url = "https://example.com/file"
+headers = ["X-Test: a", "X-Other: b"]
+
+[cloudflare]
+zone = "abc"
+name = ["a.example.com", "b.example.com"]
+
+[[dns]]
+provider = "alidns"
+domain = "example.com"
+sub = ["www", "cdn"]
+
+[[dns]]
+provider = "rfc2136"
+server = "127.0.0.1:53"
+ttl = 60
+`
+
+// 与 main.go 中同名参数的类型及默认值一致的参数集
+type testFlags struct {
+	fs       *flag.FlagSet
+	threads  int
+	maxDelay int
+	url      string
+	headers  headerFlag
+	cfZone   string
+	cfName   string
+	interval time.Duration
+}
+
+func newTestFlags(t *testing.T, args ...string) *testFlags {
+	t.Helper()
+	f := &testFlags{fs: flag.NewFlagSet("test", flag.ContinueOnError), headers: make(headerFlag)}
+	f.fs.IntVar(&f.threads, "n", 200, "")
+	f.fs.IntVar(&f.maxDelay, "tl", 9999, "")
+	f.fs.StringVar(&f.url, "url", "https://cf.xiu2.xyz/url", "")
+	f.fs.Var(f.headers, "header", "")
+	f.fs.StringVar(&f.cfZone, "cf-zone", "", "")
+	f.fs.StringVar(&f.cfName, "cf-name", "", "")
+	f.fs.DurationVar(&f.interval, "interval", 0, "")
+	if err := f.fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	wantDNS := []ddns.Options{
+		{"provider": "alidns", "domain": "example.com", "sub": "www,cdn"},
+		{"provider": "rfc2136", "server": "127.0.0.1:53", "ttl": "60"},
+	}
+	for _, tt := range []struct{ name, content string }{
+		{"config.yaml", testYAMLConfig},
+		{"config.toml", testTOMLConfig},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// 命令行指定了 -n 与 -url，以命令行为准
+			f := newTestFlags(t, "-n", "100", "-url", "https://cli.example.com/")
+			dnsList, err := loadConfig(f.fs, writeConfig(t, tt.name, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.threads != 100 || f.url != "https://cli.example.com/" {
+				t.Errorf("命令行参数应优先于配置文件：-n %d -url %s", f.threads, f.url)
+			}
+			if f.maxDelay != 300 {
+				t.Errorf("配置文件应优先于默认值：-tl %d", f.maxDelay)
+			}
+			if f.interval != 0 {
+				t.Errorf("配置文件中没有的参数应保持默认值：-interval %v", f.interval)
+			}
+			if f.cfZone != "abc" || f.cfName != "a.example.com,b.example.com" {
+				t.Errorf("分组配置项：-cf-zone %q -cf-name %q", f.cfZone, f.cfName)
+			}
+			if got := http.Header(f.headers); got.Get("X-Test") != "a" || got.Get("X-Other") != "b" {
+				t.Errorf("可重复的配置项应分别设置：%v", got)
+			}
+			if !reflect.DeepEqual(dnsList, wantDNS) {
+				t.Errorf("dns 列表 = %v\n应为 %v", dnsList, wantDNS)
+			}
+		})
+	}
+}
+
+// 命令行中指定的可重复参数不与配置文件中的值合并
+func TestLoadConfigExplicitHeaders(t *testing.T) {
+	f := newTestFlags(t, "-header", "X-Cli: c")
+	if _, err := loadConfig(f.fs, writeConfig(t, "config.yaml", testYAMLConfig)); err != nil {
+		t.Fatal(err)
+	}
+	if got := http.Header(f.headers); len(got) != 1 || got.Get("X-Cli") != "c" {
+		t.Errorf("请求头 = %v，应只有命令行中指定的", got)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct{ name, content, err string }{
+		{"config.yaml", "no_such_key: 1\n", "未知的配置项 [no_such_key]"},
+		{"config.toml", "[[dns]]\ndomain = \"example.com\"\n", "需指定 provider"},
+		{"config.yaml", "dns:\n  provider: alidns\n", "应为列表"},
+		{"config.yaml", "tl: [1\n", "解析配置文件失败"},
+		{"config.json", `{"threads": "many"}`, "配置项 [threads] 有误"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err, func(t *testing.T) {
+			f := newTestFlags(t)
+			_, err := loadConfig(f.fs, writeConfig(t, tt.name, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("错误 = %v，应包含 %q", err, tt.err)
+			}
+		})
+	}
+}
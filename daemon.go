@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/api"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/task"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+	"github.com/robfig/cron/v3"
+)
+
+// 常驻运行：按间隔或 cron 表达式重复测速，只有最优 IP 的变化超过阈值时才更新解析记录
+type daemon struct {
+	interval   time.Duration // 两次测速的间隔（从上次测速结束时算起）
+	schedule   cron.Schedule // cron 表达式，指定后忽略 interval
+	hysteresis float64       // 切换阈值（百分比），新的最优 IP 需比当前使用的 IP 好这么多才会切换
+
+	tester    *task.Tester
+	published utils.DownloadSpeedSet // 最近一次更新解析记录时使用的测速结果（只在 run 中读写）
+}
+
+// 解析调度参数，均未指定时返回 nil（即只测速一次）
+func newDaemon(interval time.Duration, cronExpr string, hysteresis float64) (*daemon, error) {
+	if interval <= 0 && cronExpr == "" {
+		return nil, nil
+	}
+	if interval > 0 && cronExpr != "" {
+		return nil, fmt.Errorf("[-interval] 与 [-cron] 只能指定其中一个")
+	}
+	if hysteresis < 0 {
+		hysteresis = 0
+	}
+	d := &daemon{interval: interval, hysteresis: hysteresis}
+	if cronExpr != "" {
+		schedule, err := cron.ParseStandard(cronExpr)
+		if err != nil {
+			return nil, fmt.Errorf("cron 表达式 [%s] 有误：%v", cronExpr, err)
+		}
+		d.schedule = schedule
+	}
+	return d, nil
+}
+
+// 启动后先测速一次，之后按计划重复，直到 ctx 取消（如收到 SIGTERM）
+func (d *daemon) run(ctx context.Context, tester *task.Tester) {
+	d.tester = tester
+	if collector != nil {
+		collector.SetTester(tester)
+	}
+	for {
+		d.runOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		next := d.next(time.Now())
+		fmt.Printf("\n下次测速时间：%s\n\n", next.Format("2006-01-02 15:04:05"))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (d *daemon) next(now time.Time) time.Time {
+	if d.schedule != nil {
+		return d.schedule.Next(now)
+	}
+	return now.Add(d.interval)
+}
+
+func (d *daemon) runOnce(ctx context.Context) {
+	info := &utils.RunInfo{Version: version, Mode: d.tester.Mode(), StartTime: time.Now(), Params: flagParams()}
+	var track func(utils.DownloadSpeedSet, error)
+	if apiServer != nil { // 常驻运行的测速也记录到 HTTP API 的历史记录中
+		track = apiServer.Track(api.SourceDaemon, d.tester)
+	}
+	speedData, err := d.tester.Run(ctx)
+	if track != nil {
+		track(speedData, err)
+	}
+	if ctx.Err() != nil { // 测速途中被取消，结果不完整，直接丢弃
+		return
+	}
+	info.EndTime = time.Now()
+	pushMetrics(d.tester, speedData, info, err)
+	if err != nil {
+		log.Printf("[错误] 测速失败：%v", err)
+		return
+	}
+	if len(speedData) == 0 {
+		fmt.Println("\n[信息] 本次测速没有可用的 IP，继续使用上一次的测速结果。")
+		return
+	}
+	if err := output.Export(speedData, info); err != nil {
+		log.Printf("[错误] %v", err)
+	}
+	recordHistory(speedData, info, d.tester.Options())
+	speedData.Print(output)
+
+	if reason, ok := d.shouldPublish(speedData); !ok {
+		fmt.Printf("\n[信息] %s，不更新解析记录。\n", reason)
+		return
+	}
+	if err := publish(speedData); err != nil { // 更新失败时不记录，下次测速时即使最优 IP 未变化也会重试
+		log.Printf("[错误] %v", err)
+		return
+	}
+	d.published = speedData
+}
+
+// 判断是否需要以本次的测速结果更新解析记录，不需要时返回原因
+func (d *daemon) shouldPublish(data utils.DownloadSpeedSet) (string, bool) {
+	if len(d.published) == 0 {
+		return "", true
+	}
+	oldIP := d.published[0].IP.String()
+	best := data[0]
+	if best.IP.String() == oldIP {
+		return "最优 IP [" + oldIP + "] 未变化", false
+	}
+	for _, v := range data {
+		if v.IP.String() != oldIP {
+			continue
+		}
+		// 当前使用的 IP 本次仍然可用时，新的最优 IP 需明显更好才切换，避免在相近的 IP 间来回切换
+		// 比较的指标与结果的排序依据一致：综合评分 > 上传速度 > 下载速度 > 延迟排序依据（未进行下载测速时）
+		ratio := d.hysteresis / 100
+		opts := d.tester.Options()
+		switch {
+		case strings.TrimSpace(opts.Score) != "": // 评分可能为负数，以差值与当前评分的绝对值比较
+			if best.Score-v.Score < math.Abs(v.Score)*ratio {
+				return fmt.Sprintf("最优 IP [%s] 的综合评分未比当前使用的 IP [%s] 高 %.2f%% 以上", best.IP, oldIP, d.hysteresis), false
+			}
+		case opts.SortByUpload && opts.UploadURL != "":
+			if best.UploadSpeed < v.UploadSpeed*(1+ratio) {
+				return fmt.Sprintf("最优 IP [%s] 的上传速度未比当前使用的 IP [%s] 高 %.2f%% 以上", best.IP, oldIP, d.hysteresis), false
+			}
+		case opts.Disable: // 未进行下载测速时以 [-sort] 指定的耗时比较
+			name, bestDelay := utils.DelaySortValue(opts.SortBy, best.PingData)
+			_, oldDelay := utils.DelaySortValue(opts.SortBy, v.PingData)
+			if float64(bestDelay) > float64(oldDelay)*(1-ratio) {
+				return fmt.Sprintf("最优 IP [%s] 的%s未比当前使用的 IP [%s] 低 %.2f%% 以上", best.IP, name, oldIP, d.hysteresis), false
+			}
+		default:
+			if best.DownloadSpeed < v.DownloadSpeed*(1+ratio) {
+				return fmt.Sprintf("最优 IP [%s] 的下载速度未比当前使用的 IP [%s] 高 %.2f%% 以上", best.IP, oldIP, d.hysteresis), false
+			}
+		}
+		return "", true
+	}
+	return "", true // 当前使用的 IP 本次已不可用
+}
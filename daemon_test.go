@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/task"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+// 测速结果中的一个 IP，各项指标均可单独指定
+type testIP struct {
+	ip       string
+	delay    time.Duration
+	connect  time.Duration
+	download float64
+	upload   float64
+	score    float64
+}
+
+func testSpeedData(ips ...testIP) utils.DownloadSpeedSet {
+	data := make(utils.DownloadSpeedSet, 0, len(ips))
+	for _, v := range ips {
+		data = append(data, utils.CloudflareIPData{
+			PingData: &utils.PingData{
+				IP:     &net.IPAddr{IP: net.ParseIP(v.ip)},
+				Delay:  v.delay,
+				Phases: utils.DelayPhases{Connect: v.connect},
+			},
+			DownloadSpeed: v.download,
+			UploadSpeed:   v.upload,
+			Score:         v.score,
+		})
+	}
+	return data
+}
+
+func TestShouldPublish(t *testing.T) {
+	old := testIP{ip: "1.1.1.1", delay: 100 * time.Millisecond, connect: 50 * time.Millisecond, download: 100, upload: 100, score: 100}
+	tests := []struct {
+		name      string
+		modify    func(o *task.Options)
+		published []testIP // 为空时即首次更新
+		data      []testIP // 第一个为本次的最优 IP
+		want      bool
+		reason    string // 不更新时的原因应包含的内容
+	}{
+		{"首次更新", nil, nil,
+			[]testIP{{ip: "2.2.2.2", download: 1}}, true, ""},
+		{"最优 IP 未变化", nil, []testIP{old},
+			[]testIP{old, {ip: "2.2.2.2", download: 50}}, false, "未变化"},
+		{"下载速度在阈值内", nil, []testIP{old},
+			[]testIP{{ip: "2.2.2.2", download: 105}, old}, false, "下载速度"},
+		{"下载速度超过阈值", nil, []testIP{old},
+			[]testIP{{ip: "2.2.2.2", download: 120}, old}, true, ""},
+		{"原 IP 已不可用", nil, []testIP{old},
+			[]testIP{{ip: "2.2.2.2", download: 1}, {ip: "3.3.3.3", download: 1}}, true, ""},
+		{"上传速度在阈值内", func(o *task.Options) { o.UploadURL = "https://example.com/"; o.SortByUpload = true }, []testIP{old},
+			[]testIP{{ip: "2.2.2.2", download: 500, upload: 105}, old}, false, "上传速度"},
+		{"上传速度超过阈值", func(o *task.Options) { o.UploadURL = "https://example.com/"; o.SortByUpload = true }, []testIP{old},
+			[]testIP{{ip: "2.2.2.2", download: 1, upload: 120}, old}, true, ""},
+		{"评分在阈值内", func(o *task.Options) { o.Score = "download" }, []testIP{old},
+			[]testIP{{ip: "2.2.2.2", download: 500, score: 105}, old}, false, "综合评分"},
+		{"评分超过阈值", func(o *task.Options) { o.Score = "download" }, []testIP{old},
+			[]testIP{{ip: "2.2.2.2", score: 120}, old}, true, ""},
+		// 负数评分以差值与当前评分的绝对值比较：-10 的 10% 为 1
+		{"负数评分在阈值内", func(o *task.Options) { o.Score = "download - delay" }, []testIP{{ip: "1.1.1.1", score: -10}},
+			[]testIP{{ip: "2.2.2.2", score: -9.5}, {ip: "1.1.1.1", score: -10}}, false, "综合评分"},
+		{"负数评分超过阈值", func(o *task.Options) { o.Score = "download - delay" }, []testIP{{ip: "1.1.1.1", score: -10}},
+			[]testIP{{ip: "2.2.2.2", score: -8}, {ip: "1.1.1.1", score: -10}}, true, ""},
+		{"延迟在阈值内", func(o *task.Options) { o.Disable = true }, []testIP{old},
+			[]testIP{{ip: "2.2.2.2", delay: 95 * time.Millisecond}, old}, false, "平均延迟"},
+		{"延迟超过阈值", func(o *task.Options) { o.Disable = true }, []testIP{old},
+			[]testIP{{ip: "2.2.2.2", delay: 80 * time.Millisecond}, old}, true, ""},
+		// 按连接耗时排序时以连接耗时比较，即使平均延迟已超过阈值
+		{"连接耗时在阈值内", func(o *task.Options) { o.Disable = true; o.SortBy = utils.SortConnect }, []testIP{old},
+			[]testIP{{ip: "2.2.2.2", delay: 50 * time.Millisecond, connect: 48 * time.Millisecond}, old}, false, "平均连接耗时"},
+		{"连接耗时超过阈值", func(o *task.Options) { o.Disable = true; o.SortBy = utils.SortConnect }, []testIP{old},
+			[]testIP{{ip: "2.2.2.2", delay: 100 * time.Millisecond, connect: 40 * time.Millisecond}, old}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := task.DefaultOptions()
+			if tt.modify != nil {
+				tt.modify(&opts)
+			}
+			tester, err := task.NewTester(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := newDaemon(time.Minute, "", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.tester = tester
+			if tt.published != nil {
+				d.published = testSpeedData(tt.published...)
+			}
+			reason, ok := d.shouldPublish(testSpeedData(tt.data...))
+			if ok != tt.want {
+				t.Fatalf("shouldPublish = %v（%s），应为 %v", ok, reason, tt.want)
+			}
+			if !strings.Contains(reason, tt.reason) {
+				t.Errorf("原因 = %q，应包含 %q", reason, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package ddns
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const (
+	defaultAliDNSAPI  = "https://alidns.aliyuncs.com"
+	defaultAliDNSLine = "default"
+	defaultAliDNSTTL  = 600
+)
+
+// 通过阿里云云解析 (AliDNS) API 更新 A/AAAA 解析记录
+type AliDNS struct {
+	APIBase      string   // API 地址，默认为官方地址，可改为本地模拟服务用于测试
+	AccessKeyID  string   // AccessKey ID
+	AccessSecret string   // AccessKey Secret
+	Domain       string   // 主域名，如 example.com
+	SubDomains   []string // 主机记录，如 www、@
+	Lines        []string // 解析线路，如 default、telecom、unicom，默认为 default
+	Count        int      // 使用测速结果中的前几个 IP，多余的记录会被删除
+	TTL          int
+	Client       *http.Client
+}
+
+type aliDNSRecord struct {
+	RecordID string `json:"RecordId"`
+	RR       string `json:"RR"`
+	Type     string `json:"Type"`
+	Value    string `json:"Value"`
+	Line     string `json:"Line"`
+}
+
+func init() {
+	Register("alidns", newAliDNS)
+}
+
+// 配置项：access_key_id、access_key_secret、domain、sub（英文逗号分隔）、line（英文逗号分隔）、num、ttl、api
+func newAliDNS(opts Options) (DNSProvider, error) {
+	if err := opts.require("access_key_id", "access_key_secret", "domain", "sub"); err != nil {
+		return nil, err
+	}
+	count, err := opts.Int("num", defaultCount)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := opts.Int("ttl", defaultAliDNSTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &AliDNS{
+		APIBase:      opts.String("api"),
+		AccessKeyID:  opts.String("access_key_id"),
+		AccessSecret: opts.String("access_key_secret"),
+		Domain:       opts.String("domain"),
+		SubDomains:   opts.List("sub"),
+		Lines:        opts.List("line"),
+		Count:        count,
+		TTL:          ttl,
+	}, nil
+}
+
+// 以测速结果的前 Count 个 IP 更新每个主机记录、每条线路的 A/AAAA 记录，返回每条记录的结果
+func (a *AliDNS) Publish(data utils.DownloadSpeedSet) (results []Result) {
+	if len(data) == 0 {
+		return
+	}
+	lines := a.Lines
+	if len(lines) == 0 {
+		lines = []string{defaultAliDNSLine}
+	}
+	ips := topIPs(data, a.Count)
+	for _, sub := range a.SubDomains {
+		for _, line := range lines {
+			for _, typ := range recordTypes {
+				if len(ips[typ]) > 0 {
+					results = append(results, a.sync(sub, line, typ, ips[typ])...)
+				}
+			}
+		}
+	}
+	return
+}
+
+// 使某个主机记录某条线路的某类解析记录与目标 IP 一致
+func (a *AliDNS) sync(sub, line, typ string, ips []string) (results []Result) {
+	name := sub + "." + a.Domain
+	if sub == "@" {
+		name = a.Domain
+	}
+	existing, err := a.list(sub, line, typ)
+	if err != nil {
+		return []Result{{Name: name, Line: line, Type: typ, Content: strings.Join(ips, ","), Err: err}}
+	}
+	unchanged, updates, creates, deletes := diffRecords(existing, ips)
+	for _, r := range unchanged {
+		results = append(results, Result{Name: name, Line: line, Type: typ, Content: r.Content, Action: ActionUnchanged})
+	}
+	for _, u := range updates {
+		params := a.recordParams(sub, line, typ, u.content)
+		params.Set("RecordId", u.ID)
+		err := a.do("UpdateDomainRecord", params, nil)
+		results = append(results, Result{Name: name, Line: line, Type: typ, Content: u.content, Action: ActionUpdated, Err: err})
+	}
+	for _, ip := range creates {
+		params := a.recordParams(sub, line, typ, ip)
+		params.Set("DomainName", a.Domain)
+		err := a.do("AddDomainRecord", params, nil)
+		results = append(results, Result{Name: name, Line: line, Type: typ, Content: ip, Action: ActionCreated, Err: err})
+	}
+	for _, r := range deletes {
+		err := a.do("DeleteDomainRecord", url.Values{"RecordId": {r.ID}}, nil)
+		results = append(results, Result{Name: name, Line: line, Type: typ, Content: r.Content, Action: ActionDeleted, Err: err})
+	}
+	return
+}
+
+func (a *AliDNS) list(sub, line, typ string) ([]record, error) {
+	subDomain := sub + "." + a.Domain
+	if sub == "@" {
+		subDomain = a.Domain
+	}
+	params := url.Values{
+		"DomainName": {a.Domain},
+		"SubDomain":  {subDomain},
+		"Type":       {typ},
+		"Line":       {line},
+		"PageSize":   {"500"},
+	}
+	var resp struct {
+		DomainRecords struct {
+			Record []aliDNSRecord `json:"Record"`
+		} `json:"DomainRecords"`
+	}
+	if err := a.do("DescribeSubDomainRecords", params, &resp); err != nil {
+		return nil, err
+	}
+	var records []record
+	for _, r := range resp.DomainRecords.Record {
+		if r.RR != sub || r.Type != typ || r.Line != line {
+			continue
+		}
+		records = append(records, record{ID: r.RecordID, Content: r.Value})
+	}
+	return records, nil
+}
+
+func (a *AliDNS) recordParams(sub, line, typ, value string) url.Values {
+	ttl := a.TTL
+	if ttl <= 0 {
+		ttl = defaultAliDNSTTL
+	}
+	return url.Values{
+		"RR":    {sub},
+		"Type":  {typ},
+		"Value": {value},
+		"Line":  {line},
+		"TTL":   {strconv.Itoa(ttl)},
+	}
+}
+
+// 调用 API（RPC 风格，HMAC-SHA1 签名），result 不为 nil 时解析返回内容
+func (a *AliDNS) do(action string, params url.Values, result interface{}) error {
+	params.Set("Action", action)
+	params.Set("Format", "JSON")
+	params.Set("Version", "2015-01-09")
+	params.Set("AccessKeyId", a.AccessKeyID)
+	params.Set("SignatureMethod", "HMAC-SHA1")
+	params.Set("SignatureVersion", "1.0")
+	params.Set("SignatureNonce", nonce())
+	params.Set("Timestamp", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	params.Set("Signature", aliDNSSign(http.MethodGet, params, a.AccessSecret))
+
+	apiBase := a.APIBase
+	if apiBase == "" {
+		apiBase = defaultAliDNSAPI
+	}
+	client := a.Client
+	if client == nil {
+		client = newHTTPClient()
+	}
+	resp, err := client.Get(strings.TrimRight(apiBase, "/") + "/?" + params.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("解析 API 响应失败 (HTTP %d)：%v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		}
+		_ = json.Unmarshal(body, &e)
+		return fmt.Errorf("API 错误 %s：%s", e.Code, e.Message)
+	}
+	if result != nil {
+		return json.Unmarshal(body, result)
+	}
+	return nil
+}
+
+// 签名：对排序后的参数做规范化编码，以 AccessSecret + "&" 为密钥计算 HMAC-SHA1
+func aliDNSSign(method string, params url.Values, secret string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, percentEncode(k)+"="+percentEncode(params.Get(k)))
+	}
+	stringToSign := method + "&" + percentEncode("/") + "&" + percentEncode(strings.Join(pairs, "&"))
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 阿里云要求的 URL 编码：空格为 %20，* 为 %2A，~ 不编码
+func percentEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
+
+func nonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
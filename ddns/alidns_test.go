@@ -0,0 +1,182 @@
+package ddns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 阿里云云解析 API 文档「签名机制」一节的示例
+func TestAliDNSSignKnownAnswer(t *testing.T) {
+	params := url.Values{
+		"Format":           {"XML"},
+		"AccessKeyId":      {"testid"},
+		"Action":           {"DescribeDomainRecords"},
+		"SignatureMethod":  {"HMAC-SHA1"},
+		"DomainName":       {"example.com"},
+		"SignatureNonce":   {"f59ed6a9-83fc-473b-9cc6-99c95df3856e"},
+		"SignatureVersion": {"1.0"},
+		"Version":          {"2015-01-09"},
+		"Timestamp":        {"2016-03-24T16:41:54Z"},
+	}
+	if got, want := aliDNSSign(http.MethodGet, params, "testsecret"), "uRpHwaSEt3J+6KQD//svCh/x+pI="; got != want {
+		t.Errorf("签名 = %s，应为 %s", got, want)
+	}
+}
+
+func TestAliDNSPercentEncode(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"2016-03-24T16:41:54Z", "2016-03-24T16%3A41%3A54Z"},
+		{"a b*c~d", "a%20b%2Ac~d"},
+		{"/", "%2F"},
+		{"电信", "%E7%94%B5%E4%BF%A1"},
+	}
+	for _, tt := range tests {
+		if got := percentEncode(tt.in); got != tt.want {
+			t.Errorf("percentEncode(%q) = %q，应为 %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+const (
+	testAliKeyID  = "testid"
+	testAliSecret = "testsecret"
+)
+
+// 本地模拟的阿里云云解析 API：校验签名，保存解析记录，并记录收到的操作
+type testAliDNSAPI struct {
+	mu      sync.Mutex
+	records map[string]aliDNSRecord // RecordId -> 记录
+	nextID  int
+	actions []string
+}
+
+func startTestAliDNSAPI(t *testing.T, existing ...aliDNSRecord) (*testAliDNSAPI, *httptest.Server) {
+	t.Helper()
+	api := &testAliDNSAPI{records: make(map[string]aliDNSRecord)}
+	for _, r := range existing {
+		api.add(r)
+	}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, srv
+}
+
+func (api *testAliDNSAPI) add(r aliDNSRecord) {
+	api.nextID++
+	r.RecordID = strconv.Itoa(api.nextID)
+	api.records[r.RecordID] = r
+}
+
+func (api *testAliDNSAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	params := req.URL.Query()
+	fail := func(code, message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"Code": code, "Message": message})
+	}
+	signature := params.Get("Signature")
+	params.Del("Signature")
+	if params.Get("AccessKeyId") != testAliKeyID || signature != aliDNSSign(req.Method, params, testAliSecret) {
+		fail("SignatureDoesNotMatch", "Specified signature is not matched with our calculation.")
+		return
+	}
+	action := params.Get("Action")
+	api.actions = append(api.actions, action)
+	switch action {
+	case "DescribeSubDomainRecords":
+		var list []aliDNSRecord
+		for _, r := range api.records {
+			if r.RR+"."+params.Get("DomainName") == params.Get("SubDomain") && r.Type == params.Get("Type") && r.Line == params.Get("Line") {
+				list = append(list, r)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].RecordID < list[j].RecordID })
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"TotalCount": len(list), "DomainRecords": map[string]interface{}{"Record": list}})
+	case "AddDomainRecord", "UpdateDomainRecord":
+		r := aliDNSRecord{RecordID: params.Get("RecordId"), RR: params.Get("RR"), Type: params.Get("Type"), Value: params.Get("Value"), Line: params.Get("Line")}
+		if action == "AddDomainRecord" {
+			api.add(r)
+		} else {
+			api.records[r.RecordID] = r
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"RecordId": r.RecordID})
+	case "DeleteDomainRecord":
+		delete(api.records, params.Get("RecordId"))
+		_ = json.NewEncoder(w).Encode(map[string]string{"RecordId": params.Get("RecordId")})
+	default:
+		fail("InvalidAction", "Specified action is not valid.")
+	}
+}
+
+func (api *testAliDNSAPI) values(rr, line string) []string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	var ips []string
+	for _, r := range api.records {
+		if r.RR == rr && r.Line == line {
+			ips = append(ips, r.Value)
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func TestAliDNSPublish(t *testing.T) {
+	existing := []aliDNSRecord{
+		{RR: "cdn", Type: "A", Value: "2.2.2.2", Line: "default"},
+		{RR: "cdn", Type: "A", Value: "3.3.3.3", Line: "default"},
+		{RR: "cdn", Type: "A", Value: "9.9.9.9", Line: "telecom"},
+	}
+	api, srv := startTestAliDNSAPI(t, existing...)
+	a := &AliDNS{
+		APIBase:      srv.URL,
+		AccessKeyID:  testAliKeyID,
+		AccessSecret: testAliSecret,
+		Domain:       "example.com",
+		SubDomains:   []string{"cdn"},
+		Count:        1,
+	}
+
+	results := a.Publish(testSpeedSet("1.1.1.1"))
+	got := make(map[string]string)
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("[%s] 失败：%v", r.Content, r.Err)
+		}
+		got[r.Content] = r.Action
+	}
+	want := map[string]string{"1.1.1.1": ActionUpdated, "3.3.3.3": ActionDeleted}
+	if len(got) != len(want) || got["1.1.1.1"] != want["1.1.1.1"] || got["3.3.3.3"] != want["3.3.3.3"] {
+		t.Errorf("结果 = %v，应为 %v", got, want)
+	}
+	if ips := api.values("cdn", "default"); len(ips) != 1 || ips[0] != "1.1.1.1" {
+		t.Errorf("更新后的记录 = %v，应为 [1.1.1.1]", ips)
+	}
+	if ips := api.values("cdn", "telecom"); len(ips) != 1 || ips[0] != "9.9.9.9" {
+		t.Errorf("其他线路的记录不应被修改：%v", ips)
+	}
+	if got := strings.Join(api.actions, " "); got != "DescribeSubDomainRecords UpdateDomainRecord DeleteDomainRecord" {
+		t.Errorf("操作 = %s", got)
+	}
+}
+
+func TestAliDNSBadSecret(t *testing.T) {
+	api, srv := startTestAliDNSAPI(t)
+	a := &AliDNS{APIBase: srv.URL, AccessKeyID: testAliKeyID, AccessSecret: "wrong", Domain: "example.com", SubDomains: []string{"cdn"}}
+
+	results := a.Publish(testSpeedSet("1.1.1.1"))
+	if len(results) != 1 || results[0].Err == nil || !strings.Contains(results[0].Err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("签名有误时应更新失败：%+v", results)
+	}
+	if len(api.records) != 0 {
+		t.Errorf("签名有误时不应修改记录：%v", api.records)
+	}
+}
@@ -0,0 +1,204 @@
+package ddns
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const defaultCloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// 通过 Cloudflare v4 API 更新 A/AAAA 解析记录
+type Cloudflare struct {
+	APIBase string   // API 地址，默认为官方地址，可改为本地模拟服务用于测试
+	Token   string   // API 令牌（自定义权限）
+	Email   string   // API 密钥（全局权限）方式需同时指定 Email 和 Key
+	Key     string   // 全局 API 密钥
+	ZoneID  string   // 区域 ID
+	Names   []string // 要更新的记录名（完整域名），如 cdn.example.com
+	Count   int      // 使用测速结果中的前几个 IP
+	TTL     int      // 1 为自动
+	Proxied bool     // 是否开启 Cloudflare 代理（小云朵）
+	Client  *http.Client
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func init() {
+	Register("cloudflare", newCloudflare)
+}
+
+// 配置项：zone、name（英文逗号分隔）、token 或 email + key、num、ttl、proxied、api
+func newCloudflare(opts Options) (DNSProvider, error) {
+	if err := opts.require("zone", "name"); err != nil {
+		return nil, err
+	}
+	if opts.String("token") == "" && (opts.String("email") == "" || opts.String("key") == "") {
+		return nil, errors.New("缺少配置项 [token] 或 [email, key]")
+	}
+	count, err := opts.Int("num", defaultCount)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := opts.Int("ttl", 1)
+	if err != nil {
+		return nil, err
+	}
+	proxied, err := opts.Bool("proxied")
+	if err != nil {
+		return nil, err
+	}
+	return &Cloudflare{
+		APIBase: opts.String("api"),
+		Token:   opts.String("token"),
+		Email:   opts.String("email"),
+		Key:     opts.String("key"),
+		ZoneID:  opts.String("zone"),
+		Names:   opts.List("name"),
+		Count:   count,
+		TTL:     ttl,
+		Proxied: proxied,
+	}, nil
+}
+
+// 以测速结果的前 Count 个 IP 更新每个记录名的 A/AAAA 记录，返回每条记录的结果
+func (c *Cloudflare) Publish(data utils.DownloadSpeedSet) (results []Result) {
+	if len(data) == 0 {
+		return
+	}
+	ips := topIPs(data, c.Count)
+	for _, name := range c.Names {
+		for _, typ := range recordTypes {
+			if len(ips[typ]) > 0 {
+				results = append(results, c.sync(name, typ, ips[typ])...)
+			}
+		}
+	}
+	return
+}
+
+// 使某个记录名的某类解析记录与目标 IP 一致
+func (c *Cloudflare) sync(name, typ string, ips []string) (results []Result) {
+	existing, err := c.list(name, typ)
+	if err != nil {
+		return []Result{{Name: name, Type: typ, Content: strings.Join(ips, ","), Err: err}}
+	}
+	unchanged, updates, creates, deletes := diffRecords(existing, ips)
+	for _, r := range unchanged {
+		results = append(results, Result{Name: name, Type: typ, Content: r.Content, Action: ActionUnchanged})
+	}
+	for _, u := range updates {
+		body := cloudflareRecord{Type: typ, Name: name, Content: u.content, TTL: c.ttl(), Proxied: c.Proxied}
+		err := c.do(http.MethodPut, c.recordsPath()+"/"+u.ID, body, nil)
+		results = append(results, Result{Name: name, Type: typ, Content: u.content, Action: ActionUpdated, Err: err})
+	}
+	for _, ip := range creates {
+		body := cloudflareRecord{Type: typ, Name: name, Content: ip, TTL: c.ttl(), Proxied: c.Proxied}
+		err := c.do(http.MethodPost, c.recordsPath(), body, nil)
+		results = append(results, Result{Name: name, Type: typ, Content: ip, Action: ActionCreated, Err: err})
+	}
+	for _, r := range deletes {
+		err := c.do(http.MethodDelete, c.recordsPath()+"/"+r.ID, nil, nil)
+		results = append(results, Result{Name: name, Type: typ, Content: r.Content, Action: ActionDeleted, Err: err})
+	}
+	return
+}
+
+func (c *Cloudflare) list(name, typ string) ([]record, error) {
+	query := url.Values{"type": {typ}, "name": {name}, "per_page": {"100"}}
+	var list []cloudflareRecord
+	if err := c.do(http.MethodGet, c.recordsPath()+"?"+query.Encode(), nil, &list); err != nil {
+		return nil, err
+	}
+	records := make([]record, 0, len(list))
+	for _, r := range list {
+		records = append(records, record{ID: r.ID, Content: r.Content})
+	}
+	return records, nil
+}
+
+func (c *Cloudflare) recordsPath() string {
+	return "/zones/" + url.PathEscape(c.ZoneID) + "/dns_records"
+}
+
+func (c *Cloudflare) ttl() int {
+	if c.TTL <= 0 {
+		return 1
+	}
+	return c.TTL
+}
+
+// 发送 API 请求，result 不为 nil 时解析返回的 result 字段
+func (c *Cloudflare) do(method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	apiBase := c.APIBase
+	if apiBase == "" {
+		apiBase = defaultCloudflareAPI
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(apiBase, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Email != "" { // API 密钥方式（全局权限）
+		req.Header.Set("X-Auth-Email", c.Email)
+		req.Header.Set("X-Auth-Key", c.Key)
+	} else { // API 令牌方式（自定义权限）
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = newHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var cfResp cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&cfResp); err != nil {
+		return fmt.Errorf("解析 API 响应失败 (HTTP %d)：%v", resp.StatusCode, err)
+	}
+	if !cfResp.Success {
+		if len(cfResp.Errors) > 0 {
+			return fmt.Errorf("API 错误 %d：%s", cfResp.Errors[0].Code, cfResp.Errors[0].Message)
+		}
+		return fmt.Errorf("API 请求失败 (HTTP %d)", resp.StatusCode)
+	}
+	if result != nil {
+		return json.Unmarshal(cfResp.Result, result)
+	}
+	return nil
+}
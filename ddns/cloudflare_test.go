@@ -0,0 +1,263 @@
+package ddns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testZoneID = "023e105f4ecef8ad9ca31a8372d0c353"
+
+// 本地模拟的 Cloudflare v4 API：保存解析记录，并记录收到的请求
+type testCloudflareAPI struct {
+	mu       sync.Mutex
+	records  map[string]cloudflareRecord // ID -> 记录
+	nextID   int
+	requests []*http.Request
+	fail     bool // 为 true 时所有请求均返回 success:false
+}
+
+func startTestCloudflareAPI(t *testing.T, existing ...cloudflareRecord) (*testCloudflareAPI, *httptest.Server) {
+	t.Helper()
+	api := &testCloudflareAPI{records: make(map[string]cloudflareRecord)}
+	for _, r := range existing {
+		api.add(r)
+	}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, srv
+}
+
+func (api *testCloudflareAPI) add(r cloudflareRecord) {
+	api.nextID++
+	r.ID = "rec" + strconv.Itoa(api.nextID)
+	api.records[r.ID] = r
+}
+
+func (api *testCloudflareAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.requests = append(api.requests, req)
+	reply := func(result interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "errors": []interface{}{}, "result": result})
+	}
+	if api.fail {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"success":false,"errors":[{"code":10000,"message":"Authentication error"}],"result":null}`))
+		return
+	}
+	prefix := "/zones/" + testZoneID + "/dns_records"
+	if !strings.HasPrefix(req.URL.Path, prefix) {
+		http.NotFound(w, req)
+		return
+	}
+	id := strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, prefix), "/")
+	var body cloudflareRecord
+	if req.Body != nil {
+		_ = json.NewDecoder(req.Body).Decode(&body)
+	}
+	switch req.Method {
+	case http.MethodGet:
+		list := []cloudflareRecord{}
+		for _, r := range api.records {
+			if r.Type == req.URL.Query().Get("type") && r.Name == req.URL.Query().Get("name") {
+				list = append(list, r)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		reply(list)
+	case http.MethodPost:
+		api.add(body)
+		reply(body)
+	case http.MethodPut:
+		body.ID = id
+		api.records[id] = body
+		reply(body)
+	case http.MethodDelete:
+		delete(api.records, id)
+		reply(map[string]string{"id": id})
+	}
+}
+
+// 某个记录名的某类记录的内容（已排序）
+func (api *testCloudflareAPI) contents(name, typ string) []string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	var ips []string
+	for _, r := range api.records {
+		if r.Name == name && r.Type == typ {
+			ips = append(ips, r.Content)
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// 收到的请求方法，如 GET PUT POST
+func (api *testCloudflareAPI) methods() string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	methods := make([]string, 0, len(api.requests))
+	for _, req := range api.requests {
+		methods = append(methods, req.Method)
+	}
+	return strings.Join(methods, " ")
+}
+
+func newTestCloudflare(apiBase string, count int) *Cloudflare {
+	return &Cloudflare{
+		APIBase: apiBase,
+		Token:   "test-token",
+		ZoneID:  testZoneID,
+		Names:   []string{"cdn.example.com"},
+		Count:   count,
+		TTL:     120,
+		Proxied: true,
+	}
+}
+
+func testARecords(ips ...string) []cloudflareRecord {
+	records := make([]cloudflareRecord, 0, len(ips))
+	for _, ip := range ips {
+		records = append(records, cloudflareRecord{Type: "A", Name: "cdn.example.com", Content: ip, TTL: 1})
+	}
+	return records
+}
+
+func TestCloudflarePublish(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		ips      []string
+		actions  map[string]string // IP -> 操作
+		methods  string
+	}{
+		{"不变", []string{"1.1.1.1"}, []string{"1.1.1.1"},
+			map[string]string{"1.1.1.1": ActionUnchanged}, "GET"},
+		{"修改", []string{"2.2.2.2"}, []string{"1.1.1.1"},
+			map[string]string{"1.1.1.1": ActionUpdated}, "GET PUT"},
+		{"新建", nil, []string{"1.1.1.1", "4.4.4.4"},
+			map[string]string{"1.1.1.1": ActionCreated, "4.4.4.4": ActionCreated}, "GET POST POST"},
+		{"删除", []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}, []string{"1.1.1.1"},
+			map[string]string{"1.1.1.1": ActionUnchanged, "2.2.2.2": ActionDeleted, "3.3.3.3": ActionDeleted}, "GET DELETE DELETE"},
+		{"修改并新建", []string{"2.2.2.2", "1.1.1.1"}, []string{"1.1.1.1", "5.5.5.5", "6.6.6.6"},
+			map[string]string{"1.1.1.1": ActionUnchanged, "5.5.5.5": ActionUpdated, "6.6.6.6": ActionCreated}, "GET PUT POST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, srv := startTestCloudflareAPI(t, testARecords(tt.existing...)...)
+			c := newTestCloudflare(srv.URL, len(tt.ips))
+
+			results := c.Publish(testSpeedSet(tt.ips...))
+			if len(results) != len(tt.actions) {
+				t.Fatalf("结果 = %+v，应为 %v", results, tt.actions)
+			}
+			for _, r := range results {
+				if r.Err != nil {
+					t.Fatalf("[%s] 失败：%v", r.Content, r.Err)
+				}
+				if r.Name != "cdn.example.com" || r.Type != "A" || r.Action != tt.actions[r.Content] {
+					t.Errorf("[%s] 的结果 = %+v，操作应为 %q", r.Content, r, tt.actions[r.Content])
+				}
+			}
+			if got := api.contents("cdn.example.com", "A"); strings.Join(got, ",") != strings.Join(sortedCopy(tt.ips), ",") {
+				t.Errorf("更新后的记录 = %v，应为 %v", got, tt.ips)
+			}
+			if got := api.methods(); got != tt.methods {
+				t.Errorf("请求 = %s，应为 %s", got, tt.methods)
+			}
+			for _, r := range api.records {
+				if action := tt.actions[r.Content]; action != ActionUnchanged && (r.TTL != 120 || !r.Proxied) {
+					t.Errorf("新建/修改的记录应为 TTL 120 且开启代理：%+v", r)
+				}
+			}
+		})
+	}
+}
+
+// A、AAAA 记录分别查询及更新，测速结果中没有的类型不会被删除
+func TestCloudflarePublishDualStack(t *testing.T) {
+	existing := append(testARecords("1.1.1.1"), cloudflareRecord{Type: "AAAA", Name: "cdn.example.com", Content: "2606:4700::1"})
+	api, srv := startTestCloudflareAPI(t, existing...)
+	c := newTestCloudflare(srv.URL, 2)
+
+	for _, r := range c.Publish(testSpeedSet("2.2.2.2", "3.3.3.3")) {
+		if r.Err != nil {
+			t.Fatalf("[%s] 失败：%v", r.Content, r.Err)
+		}
+	}
+	if got := api.contents("cdn.example.com", "A"); strings.Join(got, ",") != "2.2.2.2,3.3.3.3" {
+		t.Errorf("A 记录 = %v", got)
+	}
+	if got := api.contents("cdn.example.com", "AAAA"); len(got) != 1 {
+		t.Errorf("测速结果中没有 IPv6 时不应修改 AAAA 记录：%v", got)
+	}
+	for _, req := range api.requests {
+		if req.Method == http.MethodGet && req.URL.Query().Get("type") != "A" {
+			t.Errorf("不应查询 %s 记录", req.URL.Query().Get("type"))
+		}
+	}
+}
+
+func TestCloudflareAuthHeaders(t *testing.T) {
+	tests := []struct {
+		name                     string
+		token, email, key        string
+		authorization, authEmail string
+		authKey                  string
+	}{
+		{"API 令牌", "test-token", "", "", "Bearer test-token", "", ""},
+		{"全局 API 密钥", "", "user@example.com", "global-key", "", "user@example.com", "global-key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, srv := startTestCloudflareAPI(t)
+			c := newTestCloudflare(srv.URL, 1)
+			c.Token, c.Email, c.Key = tt.token, tt.email, tt.key
+
+			c.Publish(testSpeedSet("1.1.1.1"))
+			if len(api.requests) == 0 {
+				t.Fatal("没有收到请求")
+			}
+			for _, req := range api.requests {
+				if got := req.Header.Get("Authorization"); got != tt.authorization {
+					t.Errorf("%s %s 的 Authorization = %q，应为 %q", req.Method, req.URL.Path, got, tt.authorization)
+				}
+				if got := req.Header.Get("X-Auth-Email"); got != tt.authEmail {
+					t.Errorf("%s %s 的 X-Auth-Email = %q，应为 %q", req.Method, req.URL.Path, got, tt.authEmail)
+				}
+				if got := req.Header.Get("X-Auth-Key"); got != tt.authKey {
+					t.Errorf("%s %s 的 X-Auth-Key = %q，应为 %q", req.Method, req.URL.Path, got, tt.authKey)
+				}
+			}
+		})
+	}
+}
+
+func TestCloudflareAPIError(t *testing.T) {
+	api, srv := startTestCloudflareAPI(t, testARecords("2.2.2.2")...)
+	api.fail = true
+	c := newTestCloudflare(srv.URL, 1)
+
+	results := c.Publish(testSpeedSet("1.1.1.1"))
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("API 返回 success:false 时应更新失败：%+v", results)
+	}
+	if err := results[0].Err.Error(); !strings.Contains(err, "10000") || !strings.Contains(err, "Authentication error") {
+		t.Errorf("错误信息应包含 API 返回的错误：%s", err)
+	}
+	if got := api.methods(); got != "GET" {
+		t.Errorf("查询失败后不应继续修改记录：%s", got)
+	}
+}
+
+func sortedCopy(s []string) []string {
+	s = append([]string(nil), s...)
+	sort.Strings(s)
+	return s
+}
@@ -0,0 +1,185 @@
+package ddns
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const (
+	defaultCount   = 1
+	requestTimeout = 10 * time.Second
+)
+
+var recordTypes = []string{"A", "AAAA"}
+
+// 解析记录的操作结果
+const (
+	ActionUnchanged = "unchanged"
+	ActionCreated   = "created"
+	ActionUpdated   = "updated"
+	ActionDeleted   = "deleted"
+)
+
+// 单条解析记录的更新结果
+type Result struct {
+	Name    string
+	Line    string // 记录线路，仅部分服务商支持
+	Type    string
+	Content string
+	Action  string
+	Err     error
+}
+
+// 已有的解析记录
+type record struct {
+	ID      string
+	Content string
+}
+
+// 需要修改的解析记录及其新的内容
+type change struct {
+	record
+	content string
+}
+
+// 从测速结果中取前 count 个 IP，并按 A (IPv4) / AAAA (IPv6) 分组
+// 测速结果中没有的类型不会出现在返回值中，以免误删另一类型的解析记录
+func topIPs(data utils.DownloadSpeedSet, count int) map[string][]string {
+	if count <= 0 {
+		count = defaultCount
+	}
+	if len(data) < count {
+		count = len(data)
+	}
+	ips := make(map[string][]string)
+	for _, v := range data[:count] {
+		ip := v.IP.String()
+		ips[recordType(ip)] = append(ips[recordType(ip)], ip)
+	}
+	return ips
+}
+
+func recordType(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// 对比已有的解析记录与目标 IP：内容已是目标 IP 的记录保持不变，其余记录依次改为剩余的目标 IP，
+// 目标 IP 多出来的需要新建，已有记录多出来的需要删除
+func diffRecords(existing []record, want []string) (unchanged []record, updates []change, creates []string, deletes []record) {
+	wanted := make(map[string]bool, len(want))
+	for _, ip := range want {
+		wanted[ip] = true
+	}
+	var stale []record
+	for _, r := range existing {
+		if wanted[r.Content] {
+			wanted[r.Content] = false // 同一 IP 只保留一条记录
+			unchanged = append(unchanged, r)
+		} else {
+			stale = append(stale, r)
+		}
+	}
+	for _, ip := range want {
+		if !wanted[ip] {
+			continue
+		}
+		wanted[ip] = false
+		if len(stale) > 0 {
+			updates = append(updates, change{stale[0], ip})
+			stale = stale[1:]
+		} else {
+			creates = append(creates, ip)
+		}
+	}
+	deletes = stale
+	return
+}
+
+// 以整组记录（记录集）更新的服务商，对比新旧内容得到每个 IP 的结果，changed 表示是否需要更新
+func diffRecordSet(name, typ string, existing, want []string) (results []Result, changed bool) {
+	old := make(map[string]bool, len(existing))
+	for _, ip := range existing {
+		old[ip] = true
+	}
+	wanted := make(map[string]bool, len(want))
+	for _, ip := range want {
+		wanted[ip] = true
+		action := ActionCreated
+		if old[ip] {
+			action = ActionUnchanged
+		} else {
+			changed = true
+		}
+		results = append(results, Result{Name: name, Type: typ, Content: ip, Action: action})
+	}
+	for _, ip := range existing {
+		if !wanted[ip] {
+			changed = true
+			results = append(results, Result{Name: name, Type: typ, Content: ip, Action: ActionDeleted})
+		}
+	}
+	return
+}
+
+// 记录集更新失败时，将错误记录到所有结果中
+func failResults(results []Result, err error) []Result {
+	for i := range results {
+		if results[i].Action != ActionUnchanged {
+			results[i].Err = err
+		}
+	}
+	return results
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: requestTimeout}
+}
+
+// 拆分以英文逗号分隔的参数值
+func SplitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// 打印解析记录的更新结果
+func PrintResults(provider string, results []Result) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Printf("\n更新 %s 解析记录：\n", provider)
+	for _, r := range results {
+		name := r.Name
+		if r.Line != "" {
+			name += " (" + r.Line + ")"
+		}
+		if r.Err != nil {
+			fmt.Printf("  [失败] %s %s %s：%v\n", name, r.Type, r.Content, r.Err)
+			continue
+		}
+		fmt.Printf("  [%s] %s %s %s\n", actionText(r.Action), name, r.Type, r.Content)
+	}
+}
+
+func actionText(action string) string {
+	switch action {
+	case ActionCreated:
+		return "新建"
+	case ActionUpdated:
+		return "修改"
+	case ActionDeleted:
+		return "删除"
+	}
+	return "不变"
+}
@@ -0,0 +1,207 @@
+package ddns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const (
+	defaultDNSPodAPI  = "https://dnsapi.cn"
+	defaultDNSPodLine = "默认"
+	defaultDNSPodTTL  = 600
+)
+
+// 通过 DNSPod API 更新 A/AAAA 解析记录
+type DNSPod struct {
+	APIBase    string   // API 地址，默认为官方地址，可改为本地模拟服务用于测试
+	Token      string   // API Token，格式为 ID,Token
+	Domain     string   // 主域名，如 example.com
+	SubDomains []string // 主机记录，如 www、@
+	Lines      []string // 记录线路，如 默认、电信、联通，默认为 默认
+	Count      int      // 使用测速结果中的前几个 IP，多余的记录会被删除
+	TTL        int
+	Client     *http.Client
+}
+
+type dnspodStatus struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type dnspodRecord struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Line  string `json:"line"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func init() {
+	Register("dnspod", newDNSPod)
+}
+
+// 配置项：token、domain、sub（英文逗号分隔）、line（英文逗号分隔）、num、ttl、api
+func newDNSPod(opts Options) (DNSProvider, error) {
+	if err := opts.require("token", "domain", "sub"); err != nil {
+		return nil, err
+	}
+	count, err := opts.Int("num", defaultCount)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := opts.Int("ttl", defaultDNSPodTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &DNSPod{
+		APIBase:    opts.String("api"),
+		Token:      opts.String("token"),
+		Domain:     opts.String("domain"),
+		SubDomains: opts.List("sub"),
+		Lines:      opts.List("line"),
+		Count:      count,
+		TTL:        ttl,
+	}, nil
+}
+
+// 以测速结果的前 Count 个 IP 更新每个主机记录、每条线路的 A/AAAA 记录，返回每条记录的结果
+func (d *DNSPod) Publish(data utils.DownloadSpeedSet) (results []Result) {
+	if len(data) == 0 {
+		return
+	}
+	lines := d.Lines
+	if len(lines) == 0 {
+		lines = []string{defaultDNSPodLine}
+	}
+	ips := topIPs(data, d.Count)
+	for _, sub := range d.SubDomains {
+		for _, line := range lines {
+			for _, typ := range recordTypes {
+				if len(ips[typ]) > 0 {
+					results = append(results, d.sync(sub, line, typ, ips[typ])...)
+				}
+			}
+		}
+	}
+	return
+}
+
+// 使某个主机记录某条线路的某类解析记录与目标 IP 一致
+func (d *DNSPod) sync(sub, line, typ string, ips []string) (results []Result) {
+	name := sub + "." + d.Domain
+	if sub == "@" {
+		name = d.Domain
+	}
+	existing, err := d.list(sub, line, typ)
+	if err != nil {
+		return []Result{{Name: name, Line: line, Type: typ, Content: strings.Join(ips, ","), Err: err}}
+	}
+	unchanged, updates, creates, deletes := diffRecords(existing, ips)
+	for _, r := range unchanged {
+		results = append(results, Result{Name: name, Line: line, Type: typ, Content: r.Content, Action: ActionUnchanged})
+	}
+	for _, u := range updates {
+		err := d.do("Record.Modify", d.recordForm(sub, line, typ, u.content, u.ID), nil)
+		results = append(results, Result{Name: name, Line: line, Type: typ, Content: u.content, Action: ActionUpdated, Err: err})
+	}
+	for _, ip := range creates {
+		err := d.do("Record.Create", d.recordForm(sub, line, typ, ip, ""), nil)
+		results = append(results, Result{Name: name, Line: line, Type: typ, Content: ip, Action: ActionCreated, Err: err})
+	}
+	for _, r := range deletes {
+		err := d.do("Record.Remove", url.Values{"domain": {d.Domain}, "record_id": {r.ID}}, nil)
+		results = append(results, Result{Name: name, Line: line, Type: typ, Content: r.Content, Action: ActionDeleted, Err: err})
+	}
+	return
+}
+
+func (d *DNSPod) list(sub, line, typ string) ([]record, error) {
+	form := url.Values{"domain": {d.Domain}, "sub_domain": {sub}, "record_type": {typ}, "record_line": {line}}
+	var resp struct {
+		Records []dnspodRecord `json:"records"`
+	}
+	if err := d.do("Record.List", form, &resp); err != nil {
+		return nil, err
+	}
+	var records []record
+	for _, r := range resp.Records {
+		// 接口按前缀等方式匹配时可能返回其他记录，这里再精确过滤一次
+		if r.Name != sub || r.Type != typ || r.Line != line {
+			continue
+		}
+		records = append(records, record{ID: r.ID, Content: r.Value})
+	}
+	return records, nil
+}
+
+func (d *DNSPod) recordForm(sub, line, typ, value, id string) url.Values {
+	ttl := d.TTL
+	if ttl <= 0 {
+		ttl = defaultDNSPodTTL
+	}
+	form := url.Values{
+		"domain":      {d.Domain},
+		"sub_domain":  {sub},
+		"record_type": {typ},
+		"record_line": {line},
+		"value":       {value},
+		"ttl":         {strconv.Itoa(ttl)},
+	}
+	if id != "" {
+		form.Set("record_id", id)
+	}
+	return form
+}
+
+// 调用 API，result 不为 nil 时解析返回内容
+func (d *DNSPod) do(action string, form url.Values, result interface{}) error {
+	form.Set("login_token", d.Token)
+	form.Set("format", "json")
+	apiBase := d.APIBase
+	if apiBase == "" {
+		apiBase = defaultDNSPodAPI
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(apiBase, "/")+"/"+action, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "CloudflareSpeedTest DDNS") // DNSPod 要求请求带有 User-Agent
+
+	client := d.Client
+	if client == nil {
+		client = newHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("解析 API 响应失败 (HTTP %d)：%v", resp.StatusCode, err)
+	}
+	var status struct {
+		Status dnspodStatus `json:"status"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("解析 API 响应失败：%v", err)
+	}
+	if status.Status.Code == "10" && action == "Record.List" { // 没有记录时返回 10，视为空列表
+		return nil
+	}
+	if status.Status.Code != "1" {
+		return fmt.Errorf("API 错误 %s：%s", status.Status.Code, status.Status.Message)
+	}
+	if result != nil {
+		return json.Unmarshal(body, result)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package ddns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testDNSPodToken = "12345,abcdef"
+
+// 本地模拟的 DNSPod API：保存解析记录，并记录收到的操作
+type testDNSPodAPI struct {
+	mu      sync.Mutex
+	records map[string]dnspodRecord // ID -> 记录
+	nextID  int
+	actions []string // 如 Record.List、Record.Create
+}
+
+func startTestDNSPodAPI(t *testing.T, existing ...dnspodRecord) (*testDNSPodAPI, *httptest.Server) {
+	t.Helper()
+	api := &testDNSPodAPI{records: make(map[string]dnspodRecord)}
+	for _, r := range existing {
+		api.add(r)
+	}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, srv
+}
+
+func (api *testDNSPodAPI) add(r dnspodRecord) {
+	api.nextID++
+	r.ID = strconv.Itoa(api.nextID)
+	api.records[r.ID] = r
+}
+
+func (api *testDNSPodAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	action := strings.TrimPrefix(req.URL.Path, "/")
+	api.actions = append(api.actions, action)
+	reply := func(code, message string, extra map[string]interface{}) {
+		resp := map[string]interface{}{"status": map[string]string{"code": code, "message": message}}
+		for k, v := range extra {
+			resp[k] = v
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+	if req.PostFormValue("login_token") != testDNSPodToken || req.PostFormValue("format") != "json" {
+		reply("-1", "Login fail, please check login info.", nil)
+		return
+	}
+	if req.PostFormValue("domain") != "example.com" {
+		reply("6", "Domain id invalid", nil)
+		return
+	}
+	form := func(key string) string { return req.PostFormValue(key) }
+	switch action {
+	case "Record.List":
+		// 与实际接口一样按前缀匹配主机记录，可能返回其他主机记录
+		var list []dnspodRecord
+		for _, r := range api.records {
+			if strings.HasPrefix(r.Name, form("sub_domain")) && r.Type == form("record_type") && r.Line == form("record_line") {
+				list = append(list, r)
+			}
+		}
+		if len(list) == 0 {
+			reply("10", "No records", nil)
+			return
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		reply("1", "Action completed successful", map[string]interface{}{"records": list})
+	case "Record.Create", "Record.Modify":
+		if form("ttl") != "300" {
+			reply("-15", "TTL invalid", nil)
+			return
+		}
+		r := dnspodRecord{ID: form("record_id"), Name: form("sub_domain"), Line: form("record_line"), Type: form("record_type"), Value: form("value")}
+		if action == "Record.Create" {
+			api.add(r)
+		} else if _, ok := api.records[r.ID]; ok {
+			api.records[r.ID] = r
+		} else {
+			reply("8", "Record id invalid", nil)
+			return
+		}
+		reply("1", "Action completed successful", nil)
+	case "Record.Remove":
+		delete(api.records, form("record_id"))
+		reply("1", "Action completed successful", nil)
+	default:
+		reply("-1", "Unknown action", nil)
+	}
+}
+
+// 某个主机记录某条线路的 A 记录内容（已排序）
+func (api *testDNSPodAPI) values(sub, line string) []string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	var ips []string
+	for _, r := range api.records {
+		if r.Name == sub && r.Line == line && r.Type == "A" {
+			ips = append(ips, r.Value)
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// 除 Record.List 以外的操作
+func (api *testDNSPodAPI) writes() string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	var writes []string
+	for _, a := range api.actions {
+		if a != "Record.List" {
+			writes = append(writes, a)
+		}
+	}
+	return strings.Join(writes, " ")
+}
+
+func newTestDNSPod(apiBase string, count int, lines ...string) *DNSPod {
+	return &DNSPod{
+		APIBase:    apiBase,
+		Token:      testDNSPodToken,
+		Domain:     "example.com",
+		SubDomains: []string{"cdn"},
+		Lines:      lines,
+		Count:      count,
+		TTL:        300,
+	}
+}
+
+func testDNSPodRecords(sub, line string, ips ...string) []dnspodRecord {
+	records := make([]dnspodRecord, 0, len(ips))
+	for _, ip := range ips {
+		records = append(records, dnspodRecord{Name: sub, Line: line, Type: "A", Value: ip})
+	}
+	return records
+}
+
+func TestDNSPodPublish(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		ips      []string
+		actions  map[string]string // IP -> 操作
+		writes   string
+	}{
+		{"没有记录 (code 10)", nil, []string{"1.1.1.1", "4.4.4.4"},
+			map[string]string{"1.1.1.1": ActionCreated, "4.4.4.4": ActionCreated}, "Record.Create Record.Create"},
+		{"不变", []string{"1.1.1.1"}, []string{"1.1.1.1"},
+			map[string]string{"1.1.1.1": ActionUnchanged}, ""},
+		{"修改", []string{"2.2.2.2"}, []string{"1.1.1.1"},
+			map[string]string{"1.1.1.1": ActionUpdated}, "Record.Modify"},
+		{"删除", []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}, []string{"1.1.1.1"},
+			map[string]string{"1.1.1.1": ActionUnchanged, "2.2.2.2": ActionDeleted, "3.3.3.3": ActionDeleted}, "Record.Remove Record.Remove"},
+		{"修改并新建", []string{"2.2.2.2"}, []string{"5.5.5.5", "6.6.6.6"},
+			map[string]string{"5.5.5.5": ActionUpdated, "6.6.6.6": ActionCreated}, "Record.Modify Record.Create"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// cdn2 与 cdn 前缀相同，接口会一并返回，但不应被修改
+			existing := append(testDNSPodRecords("cdn", defaultDNSPodLine, tt.existing...), testDNSPodRecords("cdn2", defaultDNSPodLine, "9.9.9.9")...)
+			api, srv := startTestDNSPodAPI(t, existing...)
+			d := newTestDNSPod(srv.URL, len(tt.ips))
+
+			results := d.Publish(testSpeedSet(tt.ips...))
+			if len(results) != len(tt.actions) {
+				t.Fatalf("结果 = %+v，应为 %v", results, tt.actions)
+			}
+			for _, r := range results {
+				if r.Err != nil {
+					t.Fatalf("[%s] 失败：%v", r.Content, r.Err)
+				}
+				if r.Name != "cdn.example.com" || r.Line != defaultDNSPodLine || r.Action != tt.actions[r.Content] {
+					t.Errorf("[%s] 的结果 = %+v，操作应为 %q", r.Content, r, tt.actions[r.Content])
+				}
+			}
+			if got := api.values("cdn", defaultDNSPodLine); strings.Join(got, ",") != strings.Join(sortedCopy(tt.ips), ",") {
+				t.Errorf("更新后的记录 = %v，应为 %v", got, tt.ips)
+			}
+			if got := api.writes(); got != tt.writes {
+				t.Errorf("操作 = %q，应为 %q", got, tt.writes)
+			}
+			if got := api.values("cdn2", defaultDNSPodLine); len(got) != 1 || got[0] != "9.9.9.9" {
+				t.Errorf("其他主机记录不应被修改：%v", got)
+			}
+		})
+	}
+}
+
+// 每条线路分别查询及更新
+func TestDNSPodPublishLines(t *testing.T) {
+	existing := append(testDNSPodRecords("cdn", "电信", "1.1.1.1"), testDNSPodRecords("cdn", "联通", "2.2.2.2", "3.3.3.3")...)
+	api, srv := startTestDNSPodAPI(t, existing...)
+	d := newTestDNSPod(srv.URL, 1, "电信", "联通", "移动")
+
+	results := d.Publish(testSpeedSet("1.1.1.1"))
+	got := make(map[string]string)
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("[%s %s] 失败：%v", r.Line, r.Content, r.Err)
+		}
+		got[r.Line+" "+r.Content] = r.Action
+	}
+	want := map[string]string{
+		"电信 1.1.1.1": ActionUnchanged,
+		"联通 1.1.1.1": ActionUpdated,
+		"联通 3.3.3.3": ActionDeleted,
+		"移动 1.1.1.1": ActionCreated,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("结果 = %v，应为 %v", got, want)
+	}
+	for k, action := range want {
+		if got[k] != action {
+			t.Errorf("[%s] 的操作 = %q，应为 %q", k, got[k], action)
+		}
+	}
+	for _, line := range []string{"电信", "联通", "移动"} {
+		if ips := api.values("cdn", line); len(ips) != 1 || ips[0] != "1.1.1.1" {
+			t.Errorf("线路 [%s] 的记录 = %v，应为 [1.1.1.1]", line, ips)
+		}
+	}
+}
+
+func TestDNSPodAPIError(t *testing.T) {
+	api, srv := startTestDNSPodAPI(t, testDNSPodRecords("cdn", defaultDNSPodLine, "2.2.2.2")...)
+	d := newTestDNSPod(srv.URL, 1)
+	d.Token = "12345,wrong"
+
+	results := d.Publish(testSpeedSet("1.1.1.1"))
+	if len(results) != 1 || results[0].Err == nil || !strings.Contains(results[0].Err.Error(), "-1") {
+		t.Fatalf("API 返回错误时应更新失败：%+v", results)
+	}
+	if got := api.writes(); got != "" {
+		t.Errorf("查询失败后不应继续修改记录：%s", got)
+	}
+}
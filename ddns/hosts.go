@@ -0,0 +1,205 @@
+package ddns
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const (
+	hostsBegin     = "# CloudflareSpeedTest begin"
+	hostsEnd       = "# CloudflareSpeedTest end"
+	hostsBackupExt = ".cfst.bak"
+)
+
+// 在 Hosts 文件中维护一段由 CloudflareSpeedTest 管理的内容，将指定域名指向测速结果中的 IP
+// 只改写标记之间的内容，其余内容保持不变；内容无变化时不会写入文件
+type Hosts struct {
+	Path  string   // Hosts 文件路径，默认为系统 Hosts 文件
+	Names []string // 要指向优选 IP 的域名
+	Count int      // 使用测速结果中的前几个 IP，多个时各域名依次轮流分配
+}
+
+func init() {
+	Register("hosts", newHosts)
+}
+
+// 配置项：name（英文逗号分隔）、file、num
+func newHosts(opts Options) (DNSProvider, error) {
+	if err := opts.require("name"); err != nil {
+		return nil, err
+	}
+	count, err := opts.Int("num", defaultCount)
+	if err != nil {
+		return nil, err
+	}
+	return &Hosts{Path: opts.String("file"), Names: opts.List("name"), Count: count}, nil
+}
+
+// 系统 Hosts 文件路径
+func DefaultHostsPath() string {
+	if runtime.GOOS == "windows" {
+		root := os.Getenv("SystemRoot")
+		if root == "" {
+			root = `C:\Windows`
+		}
+		return filepath.Join(root, "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+// 以测速结果的前 Count 个 IP 改写 Hosts 文件中的管理段落，返回每个域名的结果
+func (h *Hosts) Publish(data utils.DownloadSpeedSet) (results []Result) {
+	if len(data) == 0 || len(h.Names) == 0 {
+		return
+	}
+	path := h.Path
+	if path == "" {
+		path = DefaultHostsPath()
+	}
+
+	count := h.Count
+	if count <= 0 {
+		count = defaultCount
+	}
+	if count > len(data) {
+		count = len(data)
+	}
+	mapping := make(map[string]string, len(h.Names))
+	for i, name := range h.Names { // 多个 IP 时依次轮流分配给各个域名
+		mapping[name] = data[i%count].IP.String()
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return h.fail(mapping, err)
+	}
+	newline := "\n"
+	if bytes.Contains(content, []byte("\r\n")) {
+		newline = "\r\n"
+	}
+	before, old, after := splitHostsBlock(string(content))
+
+	var block strings.Builder
+	block.WriteString(hostsBegin + newline)
+	for _, name := range h.Names {
+		ip := mapping[name]
+		block.WriteString(ip + " " + name + newline)
+		action := ActionCreated
+		if oldIP, ok := old[name]; ok {
+			action = ActionUpdated
+			if oldIP == ip {
+				action = ActionUnchanged
+			}
+		}
+		results = append(results, Result{Name: name, Type: recordType(ip), Content: ip, Action: action})
+	}
+	block.WriteString(hostsEnd + newline)
+	var removed []string
+	for name := range old {
+		if _, ok := mapping[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed { // 不再需要的域名从管理段落中移除
+		results = append(results, Result{Name: name, Type: recordType(old[name]), Content: old[name], Action: ActionDeleted})
+	}
+
+	if before != "" && !strings.HasSuffix(before, "\n") {
+		before += newline
+	}
+	updated := before + block.String() + after
+	if updated == string(content) {
+		return
+	}
+	if err := writeHosts(path, content, []byte(updated)); err != nil {
+		return failResults(results, err)
+	}
+	return
+}
+
+func (h *Hosts) fail(mapping map[string]string, err error) (results []Result) {
+	for _, name := range h.Names {
+		results = append(results, Result{Name: name, Type: recordType(mapping[name]), Content: mapping[name], Err: err})
+	}
+	return
+}
+
+// 拆分出管理段落前后的内容，并解析管理段落中已有的 域名 -> IP
+func splitHostsBlock(content string) (before string, old map[string]string, after string) {
+	old = make(map[string]string)
+	begin := strings.Index(content, hostsBegin)
+	if begin < 0 {
+		return content, old, ""
+	}
+	end := strings.Index(content[begin:], hostsEnd)
+	if end < 0 { // 只有开始标记时，视为管理段落一直到文件末尾
+		end = len(content) - begin
+	}
+	end += begin
+	for _, line := range strings.Split(content[begin+len(hostsBegin):end], "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, name := range fields[1:] {
+			old[name] = fields[0]
+		}
+	}
+	after = content[end:]
+	if strings.HasPrefix(after, hostsEnd) {
+		after = strings.TrimPrefix(after, hostsEnd)
+		after = strings.TrimPrefix(strings.TrimPrefix(after, "\r"), "\n")
+	}
+	return content[:begin], old, after
+}
+
+// 先备份原文件，再写入临时文件并替换，避免写入中断导致 Hosts 文件损坏
+func writeHosts(path string, oldContent, content []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		if err := os.WriteFile(path+hostsBackupExt, oldContent, mode); err != nil {
+			return fmt.Errorf("备份 Hosts 文件失败：%v", err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".hosts.cfst-*")
+	if err != nil {
+		return writeHostsInPlace(path, content, mode, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return writeHostsInPlace(path, content, mode, err)
+	}
+	return nil
+}
+
+// 无法替换文件时（如 Docker 容器中挂载的 /etc/hosts）直接写入原文件，此前已做好备份
+func writeHostsInPlace(path string, content []byte, mode os.FileMode, cause error) error {
+	if err := os.WriteFile(path, content, mode); err != nil {
+		return fmt.Errorf("写入 Hosts 文件失败：%v (%v)", err, cause)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package ddns
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func publishHosts(t *testing.T, h *Hosts, ips ...string) map[string]string {
+	t.Helper()
+	actions := make(map[string]string)
+	for _, r := range h.Publish(testSpeedSet(ips...)) {
+		if r.Err != nil {
+			t.Fatalf("[%s] 失败：%v", r.Name, r.Err)
+		}
+		actions[r.Name] = r.Action
+	}
+	return actions
+}
+
+func TestHostsPublish(t *testing.T) {
+	for _, newline := range []string{"\n", "\r\n"} {
+		t.Run(strings.NewReplacer("\r", "CR", "\n", "LF").Replace(newline), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hosts")
+			original := strings.Join([]string{"127.0.0.1 localhost", "# 自定义内容", "10.0.0.1 nas.lan", ""}, newline)
+			if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+				t.Fatal(err)
+			}
+			h := &Hosts{Path: path, Names: []string{"a.example.com", "b.example.com"}, Count: 2}
+
+			actions := publishHosts(t, h, "1.1.1.1", "2.2.2.2")
+			if actions["a.example.com"] != ActionCreated || actions["b.example.com"] != ActionCreated {
+				t.Errorf("结果 = %v，应均为新建", actions)
+			}
+			want := original + strings.Join([]string{hostsBegin, "1.1.1.1 a.example.com", "2.2.2.2 b.example.com", hostsEnd, ""}, newline)
+			first := readFile(t, path)
+			if first != want {
+				t.Fatalf("Hosts 文件 = %q\n应为 %q", first, want)
+			}
+			if backup := readFile(t, path+hostsBackupExt); backup != original {
+				t.Errorf("备份 = %q，应为原文件内容 %q", backup, original)
+			}
+			if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+				t.Errorf("应保留原文件权限：%v %v", info.Mode(), err)
+			}
+
+			// 再次以相同的 IP 更新时文件不变，也不会覆盖备份
+			actions = publishHosts(t, h, "1.1.1.1", "2.2.2.2")
+			if actions["a.example.com"] != ActionUnchanged || actions["b.example.com"] != ActionUnchanged {
+				t.Errorf("结果 = %v，应均为不变", actions)
+			}
+			if got := readFile(t, path); got != first {
+				t.Errorf("第二次更新后文件发生变化：%q", got)
+			}
+			if backup := readFile(t, path+hostsBackupExt); backup != original {
+				t.Errorf("内容无变化时不应覆盖备份：%q", backup)
+			}
+			entries, _ := os.ReadDir(filepath.Dir(path))
+			if len(entries) != 2 {
+				t.Errorf("目录中应只有 Hosts 文件及其备份（临时文件应已删除）：%v", entries)
+			}
+		})
+	}
+}
+
+// 只改写标记之间的内容，标记前后的内容保持不变
+func TestHostsPublishExistingBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	original := "127.0.0.1 localhost\n" +
+		hostsBegin + "\n" +
+		"1.1.1.1 a.example.com\n" +
+		"3.3.3.3 old.example.com\n" +
+		hostsEnd + "\n" +
+		"# 标记之后的内容\n10.0.0.1 nas.lan\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := &Hosts{Path: path, Names: []string{"a.example.com", "b.example.com"}, Count: 1}
+
+	actions := publishHosts(t, h, "2.2.2.2")
+	want := map[string]string{"a.example.com": ActionUpdated, "b.example.com": ActionCreated, "old.example.com": ActionDeleted}
+	for name, action := range want {
+		if actions[name] != action {
+			t.Errorf("[%s] 的操作 = %q，应为 %q", name, actions[name], action)
+		}
+	}
+	wantContent := "127.0.0.1 localhost\n" +
+		hostsBegin + "\n" +
+		"2.2.2.2 a.example.com\n" +
+		"2.2.2.2 b.example.com\n" +
+		hostsEnd + "\n" +
+		"# 标记之后的内容\n10.0.0.1 nas.lan\n"
+	if got := readFile(t, path); got != wantContent {
+		t.Errorf("Hosts 文件 = %q\n应为 %q", got, wantContent)
+	}
+	if backup := readFile(t, path+hostsBackupExt); backup != original {
+		t.Errorf("备份 = %q，应为原文件内容", backup)
+	}
+}
+
+// Hosts 文件不存在时新建，没有可备份的内容
+func TestHostsPublishNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	h := &Hosts{Path: path, Names: []string{"a.example.com"}}
+
+	publishHosts(t, h, "2606:4700::1")
+	if got, want := readFile(t, path), hostsBegin+"\n2606:4700::1 a.example.com\n"+hostsEnd+"\n"; got != want {
+		t.Errorf("Hosts 文件 = %q，应为 %q", got, want)
+	}
+	if _, err := os.Stat(path + hostsBackupExt); !os.IsNotExist(err) {
+		t.Errorf("原文件不存在时不应创建备份：%v", err)
+	}
+}
@@ -0,0 +1,268 @@
+package ddns
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const (
+	defaultHuaweiCloudAPI = "https://dns.myhuaweicloud.com"
+	defaultHuaweiCloudTTL = 300
+)
+
+// 通过华为云云解析服务 (DNS) v2 API 更新 A/AAAA 记录集
+type HuaweiCloud struct {
+	APIBase   string   // API 地址，默认为全局终端节点，可改为本地模拟服务用于测试
+	AccessKey string   // AK
+	SecretKey string   // SK
+	Zone      string   // 公网域名，如 example.com
+	Names     []string // 要更新的记录名（完整域名），如 cdn.example.com
+	Count     int      // 使用测速结果中的前几个 IP
+	TTL       int
+	Client    *http.Client
+
+	zoneID string
+}
+
+type huaweiRecordSet struct {
+	ID      string   `json:"id,omitempty"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl,omitempty"`
+	Records []string `json:"records"`
+}
+
+func init() {
+	Register("huaweicloud", newHuaweiCloud)
+}
+
+// 配置项：access_key、secret_key、zone、name（英文逗号分隔）、num、ttl、api
+func newHuaweiCloud(opts Options) (DNSProvider, error) {
+	if err := opts.require("access_key", "secret_key", "zone", "name"); err != nil {
+		return nil, err
+	}
+	count, err := opts.Int("num", defaultCount)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := opts.Int("ttl", defaultHuaweiCloudTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &HuaweiCloud{
+		APIBase:   opts.String("api"),
+		AccessKey: opts.String("access_key"),
+		SecretKey: opts.String("secret_key"),
+		Zone:      opts.String("zone"),
+		Names:     opts.List("name"),
+		Count:     count,
+		TTL:       ttl,
+	}, nil
+}
+
+// 以测速结果的前 Count 个 IP 更新每个记录名的 A/AAAA 记录集，返回每条记录的结果
+func (h *HuaweiCloud) Publish(data utils.DownloadSpeedSet) (results []Result) {
+	if len(data) == 0 {
+		return
+	}
+	ips := topIPs(data, h.Count)
+	for _, name := range h.Names {
+		for _, typ := range recordTypes {
+			if len(ips[typ]) > 0 {
+				results = append(results, h.sync(name, typ, ips[typ])...)
+			}
+		}
+	}
+	return
+}
+
+// 华为云一个记录名、一个类型只有一个记录集，直接以目标 IP 覆盖记录集内容
+func (h *HuaweiCloud) sync(name, typ string, ips []string) []Result {
+	fail := func(err error) []Result {
+		return []Result{{Name: name, Type: typ, Content: strings.Join(ips, ","), Err: err}}
+	}
+	zoneID, err := h.getZoneID()
+	if err != nil {
+		return fail(err)
+	}
+	fqdn := strings.TrimSuffix(name, ".") + "."
+	query := url.Values{"name": {fqdn}, "type": {typ}}
+	var list struct {
+		RecordSets []huaweiRecordSet `json:"recordsets"`
+	}
+	if err := h.do(http.MethodGet, "/v2/zones/"+zoneID+"/recordsets", query, nil, &list); err != nil {
+		return fail(err)
+	}
+	var existing *huaweiRecordSet
+	for i := range list.RecordSets { // 查询为模糊匹配，这里再精确过滤一次
+		if list.RecordSets[i].Name == fqdn && list.RecordSets[i].Type == typ {
+			existing = &list.RecordSets[i]
+			break
+		}
+	}
+
+	body := huaweiRecordSet{Name: fqdn, Type: typ, TTL: h.ttl(), Records: ips}
+	if existing == nil {
+		results, _ := diffRecordSet(name, typ, nil, ips)
+		err := h.do(http.MethodPost, "/v2/zones/"+zoneID+"/recordsets", nil, body, nil)
+		return failResults(results, err)
+	}
+	results, changed := diffRecordSet(name, typ, existing.Records, ips)
+	if !changed {
+		return results
+	}
+	for i := range results {
+		if results[i].Action == ActionCreated { // 记录集已存在，新增的 IP 属于修改记录集
+			results[i].Action = ActionUpdated
+		}
+	}
+	err = h.do(http.MethodPut, "/v2/zones/"+zoneID+"/recordsets/"+existing.ID, nil, body, nil)
+	return failResults(results, err)
+}
+
+// 根据域名查询 Zone ID
+func (h *HuaweiCloud) getZoneID() (string, error) {
+	if h.zoneID != "" {
+		return h.zoneID, nil
+	}
+	zone := strings.TrimSuffix(h.Zone, ".") + "."
+	var list struct {
+		Zones []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"zones"`
+	}
+	if err := h.do(http.MethodGet, "/v2/zones", url.Values{"type": {"public"}, "name": {zone}}, nil, &list); err != nil {
+		return "", err
+	}
+	for _, z := range list.Zones {
+		if z.Name == zone {
+			h.zoneID = z.ID
+			return h.zoneID, nil
+		}
+	}
+	return "", fmt.Errorf("未找到公网域名 [%s]", h.Zone)
+}
+
+func (h *HuaweiCloud) ttl() int {
+	if h.TTL <= 0 {
+		return defaultHuaweiCloudTTL
+	}
+	return h.TTL
+}
+
+// 发送 API 请求（AK/SK 签名），result 不为 nil 时解析返回内容
+func (h *HuaweiCloud) do(method, path string, query url.Values, body, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	apiBase := h.APIBase
+	if apiBase == "" {
+		apiBase = defaultHuaweiCloudAPI
+	}
+	u := strings.TrimRight(apiBase, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	huaweiSign(req, payload, h.AccessKey, h.SecretKey, time.Now())
+
+	client := h.Client
+	if client == nil {
+		client = newHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(respBody, &e)
+		return fmt.Errorf("API 错误 %s：%s (HTTP %d)", e.Code, e.Message, resp.StatusCode)
+	}
+	if result != nil {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return fmt.Errorf("解析 API 响应失败：%v", err)
+		}
+	}
+	return nil
+}
+
+// 华为云 API 网关 SDK-HMAC-SHA256 签名
+func huaweiSign(req *http.Request, payload []byte, ak, sk string, t time.Time) {
+	date := t.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Sdk-Date", date)
+
+	// 规范 URI：各段分别编码，且必须以 / 结尾
+	segments := strings.Split(req.URL.Path, "/")
+	for i, s := range segments {
+		segments[i] = huaweiEscape(s)
+	}
+	uri := strings.Join(segments, "/")
+	if !strings.HasSuffix(uri, "/") {
+		uri += "/"
+	}
+
+	// 规范查询字符串：按键排序
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, huaweiEscape(k)+"="+huaweiEscape(v))
+		}
+	}
+
+	signedHeaders := "host;x-sdk-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" + "x-sdk-date:" + date + "\n"
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method, uri, strings.Join(pairs, "&"), canonicalHeaders, signedHeaders, hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "SDK-HMAC-SHA256\n" + date + "\n" + hex.EncodeToString(requestHash[:])
+	mac := hmac.New(sha256.New, []byte(sk))
+	mac.Write([]byte(stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("SDK-HMAC-SHA256 Access=%s, SignedHeaders=%s, Signature=%s",
+		ak, signedHeaders, hex.EncodeToString(mac.Sum(nil))))
+}
+
+// 华为云签名要求的 URL 编码：空格为 %20，~ 不编码
+func huaweiEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
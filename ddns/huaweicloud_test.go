@@ -0,0 +1,200 @@
+package ddns
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 期望的签名由华为云官方 Go SDK (huaweicloud-sdk-go-v3 core/auth/signer) 对相同请求计算得到，
+// 请求体为 SDK 序列化的 JSON（末尾带换行）
+func TestHuaweiSignKnownAnswer(t *testing.T) {
+	date, _ := time.Parse("20060102T150405Z", "20240102T030405Z")
+	tests := []struct {
+		name, method, url, body, signature string
+	}{
+		{"GET 查询参数", http.MethodGet, "https://dns.myhuaweicloud.com/v2/zones?type=public&name=example.com.", "",
+			"8b041f76e9a5ee316a20d7eeef9c845be3758f4c478df5da2e4af5609c621aa0"},
+		{"PUT 请求体", http.MethodPut, "https://dns.myhuaweicloud.com/v2/zones/ff8080825b8fc86c015b94bc6f8712c3/recordsets/ff8080825ca865e8015caa9f452000a6",
+			`{"name":"cdn.example.com.","records":["1.1.1.1","2.2.2.2"],"ttl":300,"type":"A"}` + "\n",
+			"e35b7c09c9cd12bf9d863c068a3bee158314b9288f4a9fa83b504e9de9194c76"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			huaweiSign(req, []byte(tt.body), "AccessKey", "SecretKey", date)
+			want := "SDK-HMAC-SHA256 Access=AccessKey, SignedHeaders=host;x-sdk-date, Signature=" + tt.signature
+			if got := req.Header.Get("Authorization"); got != want {
+				t.Errorf("Authorization = %s\n应为 %s", got, want)
+			}
+			if got := req.Header.Get("X-Sdk-Date"); got != "20240102T030405Z" {
+				t.Errorf("X-Sdk-Date = %s", got)
+			}
+		})
+	}
+}
+
+// 与官方 SDK 的规范查询字符串测试用例一致
+func TestHuaweiEscape(t *testing.T) {
+	if got, want := huaweiEscape("一 (&=?!#%.*)"), "%E4%B8%80%20%28%26%3D%3F%21%23%25.%2A%29"; got != want {
+		t.Errorf("huaweiEscape = %s，应为 %s", got, want)
+	}
+	if got := huaweiEscape("a-b_c.d~e"); got != "a-b_c.d~e" {
+		t.Errorf("非保留字符不应编码：%s", got)
+	}
+}
+
+const testHuaweiZoneID = "ff8080825b8fc86c015b94bc6f8712c3"
+
+// 本地模拟的华为云 DNS API：以相同的算法校验签名，保存记录集，并记录收到的请求
+type testHuaweiAPI struct {
+	mu         sync.Mutex
+	recordSets map[string]huaweiRecordSet // ID -> 记录集
+	requests   []string                   // 如 GET /v2/zones
+}
+
+func (api *testHuaweiAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.requests = append(api.requests, req.Method+" "+req.URL.Path)
+	fail := func(status int, code, message string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"code": code, "message": message})
+	}
+	body, _ := io.ReadAll(req.Body)
+	date, err := time.Parse("20060102T150405Z", req.Header.Get("X-Sdk-Date"))
+	if err != nil {
+		fail(http.StatusUnauthorized, "APIGW.0301", "Incorrect IAM authentication information")
+		return
+	}
+	check, _ := http.NewRequest(req.Method, "http://"+req.Host+req.URL.RequestURI(), bytes.NewReader(body))
+	huaweiSign(check, body, "AccessKey", "SecretKey", date)
+	if req.Header.Get("Authorization") != check.Header.Get("Authorization") {
+		fail(http.StatusUnauthorized, "APIGW.0301", "Incorrect IAM authentication information")
+		return
+	}
+	recordSetsPath := "/v2/zones/" + testHuaweiZoneID + "/recordsets"
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/v2/zones":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"zones": []map[string]string{
+			{"id": "other", "name": "sub.example.com."}, // 模糊匹配返回的其他域名
+			{"id": testHuaweiZoneID, "name": "example.com."},
+		}})
+	case req.Method == http.MethodGet && req.URL.Path == recordSetsPath:
+		var list []huaweiRecordSet
+		for _, rs := range api.recordSets {
+			if strings.HasSuffix(rs.Name, req.URL.Query().Get("name")) && rs.Type == req.URL.Query().Get("type") {
+				list = append(list, rs)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"recordsets": list})
+	case req.Method == http.MethodPost && req.URL.Path == recordSetsPath:
+		var rs huaweiRecordSet
+		_ = json.Unmarshal(body, &rs)
+		rs.ID = "new"
+		api.recordSets[rs.ID] = rs
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(rs)
+	case req.Method == http.MethodPut && strings.HasPrefix(req.URL.Path, recordSetsPath+"/"):
+		var rs huaweiRecordSet
+		_ = json.Unmarshal(body, &rs)
+		rs.ID = strings.TrimPrefix(req.URL.Path, recordSetsPath+"/")
+		if _, ok := api.recordSets[rs.ID]; !ok {
+			fail(http.StatusNotFound, "DNS.0004", "The recordset does not exist.")
+			return
+		}
+		api.recordSets[rs.ID] = rs
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(rs)
+	default:
+		fail(http.StatusNotFound, "APIGW.0101", "The API does not exist or has not been published in the environment")
+	}
+}
+
+func newTestHuaweiCloud(t *testing.T, existing ...huaweiRecordSet) (*testHuaweiAPI, *HuaweiCloud) {
+	t.Helper()
+	api := &testHuaweiAPI{recordSets: make(map[string]huaweiRecordSet)}
+	for _, rs := range existing {
+		api.recordSets[rs.ID] = rs
+	}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, &HuaweiCloud{
+		APIBase:   srv.URL,
+		AccessKey: "AccessKey",
+		SecretKey: "SecretKey",
+		Zone:      "example.com",
+		Names:     []string{"cdn.example.com"},
+		Count:     2,
+		TTL:       300,
+	}
+}
+
+func TestHuaweiCloudPublish(t *testing.T) {
+	api, h := newTestHuaweiCloud(t, huaweiRecordSet{ID: "rs1", Name: "cdn.example.com.", Type: "A", TTL: 300, Records: []string{"1.1.1.1", "3.3.3.3"}})
+
+	results := h.Publish(testSpeedSet("1.1.1.1", "2.2.2.2"))
+	got := make(map[string]string)
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("[%s] 失败：%v", r.Content, r.Err)
+		}
+		got[r.Content] = r.Action
+	}
+	want := map[string]string{"1.1.1.1": ActionUnchanged, "2.2.2.2": ActionUpdated, "3.3.3.3": ActionDeleted}
+	for ip, action := range want {
+		if got[ip] != action {
+			t.Errorf("[%s] 的操作 = %q，应为 %q", ip, got[ip], action)
+		}
+	}
+	if rs := api.recordSets["rs1"]; strings.Join(rs.Records, ",") != "1.1.1.1,2.2.2.2" || rs.TTL != 300 {
+		t.Errorf("更新后的记录集 = %+v", rs)
+	}
+	if got := strings.Join(api.requests, ", "); got != "GET /v2/zones, GET /v2/zones/"+testHuaweiZoneID+"/recordsets, PUT /v2/zones/"+testHuaweiZoneID+"/recordsets/rs1" {
+		t.Errorf("请求 = %s", got)
+	}
+
+	// 记录集已是目标 IP 时不再修改，Zone ID 已缓存
+	api.requests = nil
+	for _, r := range h.Publish(testSpeedSet("1.1.1.1", "2.2.2.2")) {
+		if r.Err != nil || r.Action != ActionUnchanged {
+			t.Errorf("记录未变化时结果应为 unchanged：%+v", r)
+		}
+	}
+	if len(api.requests) != 1 {
+		t.Errorf("记录未变化时只应查询记录集：%v", api.requests)
+	}
+}
+
+func TestHuaweiCloudCreate(t *testing.T) {
+	api, h := newTestHuaweiCloud(t)
+	for _, r := range h.Publish(testSpeedSet("1.1.1.1")) {
+		if r.Err != nil || r.Action != ActionCreated {
+			t.Errorf("没有记录集时应新建：%+v", r)
+		}
+	}
+	if rs, ok := api.recordSets["new"]; !ok || rs.Name != "cdn.example.com." || strings.Join(rs.Records, ",") != "1.1.1.1" {
+		t.Errorf("新建的记录集 = %+v", api.recordSets)
+	}
+}
+
+func TestHuaweiCloudBadKey(t *testing.T) {
+	api, h := newTestHuaweiCloud(t)
+	h.SecretKey = "wrong"
+	results := h.Publish(testSpeedSet("1.1.1.1"))
+	if len(results) != 1 || results[0].Err == nil || !strings.Contains(results[0].Err.Error(), "APIGW.0301") {
+		t.Fatalf("签名有误时应更新失败：%+v", results)
+	}
+	if len(api.recordSets) != 0 {
+		t.Errorf("签名有误时不应修改记录：%v", api.recordSets)
+	}
+}
@@ -0,0 +1,93 @@
+package ddns
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+// 解析记录服务商：以排序后的测速结果更新解析记录，返回每条记录的结果
+type DNSProvider interface {
+	Publish(data utils.DownloadSpeedSet) []Result
+}
+
+// 服务商配置项，键名见各服务商的 newXxx 函数
+type Options map[string]string
+
+// 根据配置项创建服务商
+type Factory func(opts Options) (DNSProvider, error)
+
+var providers = make(map[string]Factory)
+
+// 注册服务商，name 即配置中选择服务商时使用的名称
+func Register(name string, factory Factory) {
+	providers[strings.ToLower(name)] = factory
+}
+
+// 按名称创建服务商
+func New(name string, opts Options) (DNSProvider, error) {
+	factory, ok := providers[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("未知的解析服务商 [%s]，可选：%s", name, strings.Join(Providers(), ", "))
+	}
+	return factory(opts)
+}
+
+// 已注册的服务商名称
+func Providers() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (o Options) String(key string) string {
+	return strings.TrimSpace(o[key])
+}
+
+func (o Options) List(key string) []string {
+	return SplitList(o[key])
+}
+
+func (o Options) Int(key string, def int) (int, error) {
+	v := o.String(key)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("配置项 [%s] 不是有效的整数：%s", key, v)
+	}
+	return i, nil
+}
+
+func (o Options) Bool(key string) (bool, error) {
+	v := o.String(key)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("配置项 [%s] 不是有效的布尔值：%s", key, v)
+	}
+	return b, nil
+}
+
+// 检查必填的配置项
+func (o Options) require(keys ...string) error {
+	var missing []string
+	for _, key := range keys {
+		if o.String(key) == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("缺少配置项 [%s]", strings.Join(missing, ", "))
+	}
+	return nil
+}
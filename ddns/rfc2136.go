@@ -0,0 +1,178 @@
+package ddns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultRFC2136TTL = 300
+	defaultTSIGAlgo   = "hmac-sha256"
+)
+
+// 通过 RFC 2136 动态更新（可选 TSIG 签名）更新 A/AAAA 记录，适用于 BIND 等自建 DNS 服务器
+type RFC2136 struct {
+	Server    string   // DNS 服务器地址，如 127.0.0.1:53，未指定端口时默认 53
+	Zone      string   // 区域，如 example.com
+	Names     []string // 要更新的记录名（完整域名），如 cdn.example.com
+	Count     int      // 使用测速结果中的前几个 IP
+	TTL       int
+	KeyName   string // TSIG 密钥名，为空时不签名
+	KeySecret string // TSIG 密钥（Base64）
+	KeyAlgo   string // TSIG 算法，如 hmac-sha256、hmac-sha512，默认 hmac-sha256
+	Transport string // udp 或 tcp，默认 udp
+	Timeout   time.Duration
+}
+
+func init() {
+	Register("rfc2136", newRFC2136)
+}
+
+// 配置项：server、zone、name（英文逗号分隔）、num、ttl、key_name、key_secret、key_algo、transport
+func newRFC2136(opts Options) (DNSProvider, error) {
+	if err := opts.require("server", "zone", "name"); err != nil {
+		return nil, err
+	}
+	if (opts.String("key_name") == "") != (opts.String("key_secret") == "") {
+		return nil, fmt.Errorf("配置项 [key_name] 与 [key_secret] 需同时指定")
+	}
+	count, err := opts.Int("num", defaultCount)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := opts.Int("ttl", defaultRFC2136TTL)
+	if err != nil {
+		return nil, err
+	}
+	return &RFC2136{
+		Server:    opts.String("server"),
+		Zone:      opts.String("zone"),
+		Names:     opts.List("name"),
+		Count:     count,
+		TTL:       ttl,
+		KeyName:   opts.String("key_name"),
+		KeySecret: opts.String("key_secret"),
+		KeyAlgo:   opts.String("key_algo"),
+		Transport: opts.String("transport"),
+	}, nil
+}
+
+// 以测速结果的前 Count 个 IP 更新每个记录名的 A/AAAA 记录，返回每条记录的结果
+func (r *RFC2136) Publish(data utils.DownloadSpeedSet) (results []Result) {
+	if len(data) == 0 {
+		return
+	}
+	ips := topIPs(data, r.Count)
+	for _, name := range r.Names {
+		for _, typ := range recordTypes {
+			if len(ips[typ]) > 0 {
+				results = append(results, r.sync(name, typ, ips[typ])...)
+			}
+		}
+	}
+	return
+}
+
+// 先查询服务器上现有的记录，内容不同时在一个更新消息中删除整个记录集并写入新的记录
+func (r *RFC2136) sync(name, typ string, ips []string) []Result {
+	fqdn := dns.Fqdn(name)
+	rrType := dns.StringToType[typ]
+	existing, err := r.query(fqdn, rrType)
+	if err != nil {
+		return []Result{{Name: name, Type: typ, Content: strings.Join(ips, ","), Err: err}}
+	}
+	results, changed := diffRecordSet(name, typ, existing, ips)
+	if !changed {
+		return results
+	}
+
+	rrs := make([]dns.RR, 0, len(ips))
+	for _, ip := range ips {
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", fqdn, r.ttl(), typ, ip))
+		if err != nil {
+			return failResults(results, err)
+		}
+		rrs = append(rrs, rr)
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(r.Zone))
+	m.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: fqdn, Rrtype: rrType, Class: dns.ClassINET}}})
+	m.Insert(rrs)
+	return failResults(results, r.exchange(m))
+}
+
+// 直接向该服务器查询现有的记录
+func (r *RFC2136) query(fqdn string, rrType uint16) ([]string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(fqdn, rrType)
+	m.RecursionDesired = false
+	resp, _, err := r.client().Exchange(m, r.server())
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("查询失败：%s", dns.RcodeToString[resp.Rcode])
+	}
+	var contents []string
+	for _, rr := range resp.Answer {
+		switch v := rr.(type) {
+		case *dns.A:
+			contents = append(contents, v.A.String())
+		case *dns.AAAA:
+			contents = append(contents, v.AAAA.String())
+		}
+	}
+	return contents, nil
+}
+
+func (r *RFC2136) exchange(m *dns.Msg) error {
+	c := r.client()
+	if r.KeyName != "" {
+		keyName := dns.Fqdn(r.KeyName)
+		c.TsigSecret = map[string]string{keyName: r.KeySecret}
+		m.SetTsig(keyName, r.algorithm(), 300, time.Now().Unix())
+	}
+	resp, _, err := c.Exchange(m, r.server())
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("更新失败：%s", dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
+
+func (r *RFC2136) client() *dns.Client {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = requestTimeout
+	}
+	return &dns.Client{Net: r.Transport, Timeout: timeout}
+}
+
+func (r *RFC2136) server() string {
+	if _, _, err := net.SplitHostPort(r.Server); err != nil {
+		return net.JoinHostPort(r.Server, "53")
+	}
+	return r.Server
+}
+
+func (r *RFC2136) algorithm() string {
+	algo := strings.ToLower(r.KeyAlgo)
+	if algo == "" {
+		algo = defaultTSIGAlgo
+	}
+	return dns.Fqdn(algo)
+}
+
+func (r *RFC2136) ttl() int {
+	if r.TTL <= 0 {
+		return defaultRFC2136TTL
+	}
+	return r.TTL
+}
@@ -0,0 +1,197 @@
+package ddns
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+	"github.com/miekg/dns"
+)
+
+const (
+	testZone      = "example.com."
+	testKeyName   = "cfst-key."
+	testKeySecret = "c2VjcmV0LWtleS1mb3ItY2ZzdC10ZXN0cw==" // secret-key-for-cfst-tests
+)
+
+// 进程内的 DNS 服务器：应答查询，校验 TSIG 后执行 UPDATE，并记录收到的 UPDATE 消息
+type testDNSServer struct {
+	mu      sync.Mutex
+	records map[string][]string // "name type" -> IP
+	updates []*dns.Msg
+	addr    string
+}
+
+func startTestDNSServer(t *testing.T, records map[string][]string) *testDNSServer {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("无法监听 UDP 端口：%v", err)
+	}
+	s := &testDNSServer{records: records, addr: pc.LocalAddr().String()}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn:        pc,
+		Handler:           s,
+		TsigSecret:        map[string]string{testKeyName: testKeySecret},
+		NotifyStartedFunc: func() { close(started) },
+		MsgAcceptFunc:     func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept }, // 默认不接受 UPDATE
+	}
+	go func() { _ = srv.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return s
+}
+
+func (s *testDNSServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	switch req.Opcode {
+	case dns.OpcodeQuery:
+		q := req.Question[0]
+		for _, ip := range s.records[q.Name+" "+dns.TypeToString[q.Qtype]] {
+			rr, _ := dns.NewRR(q.Name + " 300 IN " + dns.TypeToString[q.Qtype] + " " + ip)
+			resp.Answer = append(resp.Answer, rr)
+		}
+	case dns.OpcodeUpdate:
+		if req.IsTsig() == nil || w.TsigStatus() != nil {
+			resp.Rcode = dns.RcodeNotAuth
+			_ = w.WriteMsg(resp)
+			return
+		}
+		s.updates = append(s.updates, req.Copy())
+		for _, rr := range req.Ns {
+			h := rr.Header()
+			key := h.Name + " " + dns.TypeToString[h.Rrtype]
+			switch h.Class {
+			case dns.ClassANY: // 删除整个记录集
+				delete(s.records, key)
+			case dns.ClassINET:
+				switch v := rr.(type) {
+				case *dns.A:
+					s.records[key] = append(s.records[key], v.A.String())
+				case *dns.AAAA:
+					s.records[key] = append(s.records[key], v.AAAA.String())
+				}
+			}
+		}
+		tsig := req.IsTsig()
+		resp.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	}
+	_ = w.WriteMsg(resp)
+}
+
+func (s *testDNSServer) snapshot(key string) ([]string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ips := append([]string(nil), s.records[key]...)
+	sort.Strings(ips)
+	return ips, len(s.updates)
+}
+
+func testSpeedSet(ips ...string) utils.DownloadSpeedSet {
+	data := make(utils.DownloadSpeedSet, 0, len(ips))
+	for _, ip := range ips {
+		data = append(data, utils.CloudflareIPData{PingData: &utils.PingData{IP: &net.IPAddr{IP: net.ParseIP(ip)}, Sended: 4, Received: 4}})
+	}
+	return data
+}
+
+func newTestRFC2136(addr, secret string) *RFC2136 {
+	return &RFC2136{
+		Server:    addr,
+		Zone:      "example.com",
+		Names:     []string{"cdn.example.com"},
+		Count:     1,
+		TTL:       120,
+		KeyName:   "cfst-key",
+		KeySecret: secret,
+		Timeout:   2 * time.Second,
+	}
+}
+
+func TestRFC2136Publish(t *testing.T) {
+	s := startTestDNSServer(t, map[string][]string{
+		"cdn.example.com. A": {"1.1.1.1", "2.2.2.2", "3.3.3.3"},
+	})
+	r := newTestRFC2136(s.addr, testKeySecret)
+
+	results := r.Publish(testSpeedSet("4.4.4.4", "5.5.5.5", "2606:4700::1"))
+	actions := make(map[string]string)
+	for _, res := range results {
+		if res.Err != nil {
+			t.Fatalf("更新 [%s] 失败：%v", res.Content, res.Err)
+		}
+		actions[res.Content] = res.Action
+	}
+	want := map[string]string{"4.4.4.4": ActionCreated, "1.1.1.1": ActionDeleted, "2.2.2.2": ActionDeleted, "3.3.3.3": ActionDeleted}
+	if len(actions) != len(want) {
+		t.Fatalf("结果 = %v，应为 %v", actions, want)
+	}
+	for ip, action := range want {
+		if actions[ip] != action {
+			t.Errorf("[%s] 的操作 = %q，应为 %q", ip, actions[ip], action)
+		}
+	}
+
+	ips, updates := s.snapshot("cdn.example.com. A")
+	if len(ips) != 1 || ips[0] != "4.4.4.4" {
+		t.Fatalf("更新后的记录 = %v，应只保留 [4.4.4.4]", ips)
+	}
+	if updates != 1 {
+		t.Fatalf("UPDATE 消息数量 = %d，应为 1", updates)
+	}
+
+	m := s.updates[0]
+	if len(m.Question) != 1 || m.Question[0].Name != testZone || m.Question[0].Qtype != dns.TypeSOA {
+		t.Errorf("UPDATE 的区域 = %v，应为 %s SOA", m.Question, testZone)
+	}
+	if tsig := m.IsTsig(); tsig == nil || tsig.Hdr.Name != testKeyName || tsig.Algorithm != dns.HmacSHA256 {
+		t.Errorf("UPDATE 应以 [%s] %s 签名：%v", testKeyName, dns.HmacSHA256, tsig)
+	}
+	if len(m.Ns) != 2 {
+		t.Fatalf("UPDATE 的记录 = %v，应为删除记录集及新增一条记录", m.Ns)
+	}
+	if h := m.Ns[0].Header(); h.Class != dns.ClassANY || h.Rrtype != dns.TypeA || h.Name != "cdn.example.com." {
+		t.Errorf("第一条应删除整个 A 记录集：%v", m.Ns[0])
+	}
+	if a, ok := m.Ns[1].(*dns.A); !ok || a.A.String() != "4.4.4.4" || a.Hdr.Ttl != 120 || a.Hdr.Class != dns.ClassINET {
+		t.Errorf("第二条应为新增的 A 记录 4.4.4.4 (TTL 120)：%v", m.Ns[1])
+	}
+
+	// 记录已是最优 IP 时不再发送 UPDATE
+	for _, res := range r.Publish(testSpeedSet("4.4.4.4")) {
+		if res.Err != nil || res.Action != ActionUnchanged {
+			t.Errorf("记录未变化时结果应为 unchanged：%+v", res)
+		}
+	}
+	if _, updates := s.snapshot("cdn.example.com. A"); updates != 1 {
+		t.Errorf("记录未变化时不应发送 UPDATE，实际共 %d 条", updates)
+	}
+}
+
+func TestRFC2136BadKey(t *testing.T) {
+	s := startTestDNSServer(t, map[string][]string{
+		"cdn.example.com. A": {"1.1.1.1"},
+	})
+	r := newTestRFC2136(s.addr, "d3Jvbmcta2V5") // wrong-key
+
+	results := r.Publish(testSpeedSet("4.4.4.4"))
+	failed := false
+	for _, res := range results {
+		if res.Action != ActionUnchanged && res.Err != nil {
+			failed = true
+		}
+	}
+	if !failed {
+		t.Fatalf("TSIG 密钥错误时应更新失败：%+v", results)
+	}
+	if ips, updates := s.snapshot("cdn.example.com. A"); updates != 0 || len(ips) != 1 || ips[0] != "1.1.1.1" {
+		t.Errorf("TSIG 密钥错误时不应修改记录：%v (%d 条 UPDATE)", ips, updates)
+	}
+}
@@ -0,0 +1,118 @@
+package ddns
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+// 以 JSON 格式将测速结果的前 Count 个 IP 发送到指定地址，便于对接自己的程序
+type Webhook struct {
+	URL    string
+	Method string // 请求方法，默认 POST
+	Count  int    // 发送测速结果中的前几个 IP
+	Client *http.Client
+}
+
+// 发送的内容
+type webhookPayload struct {
+	Time    time.Time         `json:"time"`
+	Results []*utils.IPRecord `json:"results"`
+}
+
+func init() {
+	Register("webhook", newWebhook)
+}
+
+// 配置项：url、method、num
+func newWebhook(opts Options) (DNSProvider, error) {
+	if err := opts.require("url"); err != nil {
+		return nil, err
+	}
+	count, err := opts.Int("num", defaultCount)
+	if err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(opts.String("url")); err != nil || u.Host == "" {
+		return nil, fmt.Errorf("无效的 url，应为 http(s)://主机/路径 的形式")
+	}
+	return &Webhook{URL: opts.String("url"), Method: strings.ToUpper(opts.String("method")), Count: count}, nil
+}
+
+func (w *Webhook) Publish(data utils.DownloadSpeedSet) []Result {
+	if len(data) == 0 {
+		return nil
+	}
+	count := w.Count
+	if count <= 0 {
+		count = defaultCount
+	}
+	if count > len(data) {
+		count = len(data)
+	}
+	payload := webhookPayload{Time: time.Now()}
+	ips := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		payload.Results = append(payload.Results, data[i].ToRecord())
+		ips = append(ips, data[i].IP.String())
+	}
+	method := w.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	result := Result{Name: w.displayURL(), Type: method, Content: strings.Join(ips, ","), Action: ActionUpdated}
+	result.Err = w.send(method, payload)
+	return []Result{result}
+}
+
+func (w *Webhook) send(method string, payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return w.redactError(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = newHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return w.redactError(err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// 结果及错误中显示的地址，只保留协议及主机，路径和查询参数中常带有令牌
+func (w *Webhook) displayURL() string {
+	u, err := url.Parse(w.URL)
+	if err != nil || u.Host == "" {
+		return "webhook"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// 请求出错时错误信息中带有完整地址，替换为 displayURL
+func (w *Webhook) redactError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = w.displayURL()
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package ddns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testWebhookPath = "/hook/secret-token?key=secret-key"
+
+// 结果及错误中只显示协议及主机，不泄露路径和查询参数中的令牌
+func checkRedacted(t *testing.T, r Result, srvURL string) {
+	t.Helper()
+	if r.Name != srvURL {
+		t.Errorf("结果中的地址 = %q，应为 %q", r.Name, srvURL)
+	}
+	if r.Err != nil && strings.Contains(r.Err.Error(), "secret") {
+		t.Errorf("错误信息中不应包含令牌：%v", r.Err)
+	}
+}
+
+func TestWebhookPublish(t *testing.T) {
+	var got webhookPayload
+	var method, uri string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		method, uri = req.Method, req.URL.RequestURI()
+		if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+			t.Errorf("请求内容不是 JSON：%v", err)
+		}
+	}))
+	defer srv.Close()
+	provider, err := newWebhook(Options{"url": srv.URL + testWebhookPath, "method": "put", "num": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := provider.Publish(testSpeedSet("1.1.1.1", "2.2.2.2", "3.3.3.3"))
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("结果 = %+v", results)
+	}
+	checkRedacted(t, results[0], srv.URL)
+	if r := results[0]; r.Type != http.MethodPut || r.Content != "1.1.1.1,2.2.2.2" || r.Action != ActionUpdated {
+		t.Errorf("结果 = %+v", r)
+	}
+	if method != http.MethodPut || uri != testWebhookPath {
+		t.Errorf("请求 = %s %s，应发送到完整地址", method, uri)
+	}
+	if len(got.Results) != 2 || got.Results[0].IP != "1.1.1.1" || got.Time.IsZero() {
+		t.Errorf("发送的内容 = %+v", got)
+	}
+}
+
+func TestWebhookErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	for _, tt := range []struct{ name, base, err string }{
+		{"HTTP 状态码", srv.URL, "HTTP 403"},
+		{"连接失败", closed.URL, closed.URL},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Webhook{URL: tt.base + testWebhookPath}
+			results := w.Publish(testSpeedSet("1.1.1.1"))
+			if len(results) != 1 || results[0].Err == nil || !strings.Contains(results[0].Err.Error(), tt.err) {
+				t.Fatalf("结果 = %+v，错误应包含 %q", results, tt.err)
+			}
+			checkRedacted(t, results[0], tt.base)
+		})
+	}
+}
+
+func TestNewWebhookInvalidURL(t *testing.T) {
+	for _, u := range []string{"example.com/hook", "http://%zz/secret"} {
+		if _, err := newWebhook(Options{"url": u}); err == nil || strings.Contains(err.Error(), "secret") {
+			t.Errorf("url [%s] 的错误 = %v，应报错且不包含地址", u, err)
+		}
+	}
+}
@@ -3,6 +3,11 @@ module github.com/GuangYu-yu/CloudflareSpeedTest
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/VividCortex/ewma v1.1.1
 	github.com/cheggaaa/pb/v3 v3.0.4
+	github.com/miekg/dns v1.1.50
+	github.com/robfig/cron/v3 v3.0.1
+	golang.org/x/net v0.0.0-20210726213435-c6fcb2dbf985
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,24 @@
+module github.com/GuangYu-yu/CloudflareSpeedTest/h3
+
+go 1.26.0
+
+require (
+	github.com/GuangYu-yu/CloudflareSpeedTest v0.0.0-00010101000000-000000000000
+	github.com/quic-go/quic-go v0.63.0
+)
+
+require (
+	github.com/VividCortex/ewma v1.1.1 // indirect
+	github.com/cheggaaa/pb/v3 v3.0.4 // indirect
+	github.com/fatih/color v1.7.0 // indirect
+	github.com/mattn/go-colorable v0.1.2 // indirect
+	github.com/mattn/go-isatty v0.0.10 // indirect
+	github.com/mattn/go-runewidth v0.0.7 // indirect
+	github.com/quic-go/qpack v0.6.0 // indirect
+	golang.org/x/crypto v0.54.0 // indirect
+	golang.org/x/net v0.56.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+)
+
+replace github.com/GuangYu-yu/CloudflareSpeedTest => ../
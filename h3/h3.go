@@ -0,0 +1,52 @@
+// HTTP/3 (QUIC) 支持，基于 quic-go 实现 task.HTTP3，导入本包即可使用 HTTP3 模式 ([-http3])。
+//
+// quic-go 需要较新的 Go 版本，而主程序以 Go 1.16 构建以支持旧系统，因此本包为单独的模块。
+// 在本目录中执行以下命令，即可构建包含 HTTP/3 支持的主程序：
+//
+//	go build -overlay overlay.json -o CloudflareST github.com/GuangYu-yu/CloudflareSpeedTest
+//
+// overlay.json 在构建时向主程序加入 link.go.txt（即导入本包），主程序的源码及 go.mod 均不需要修改。
+package h3
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/task"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+const nextProto = "h3" // HTTP/3 的 ALPN
+
+func init() {
+	task.RegisterHTTP3(HTTP3{})
+}
+
+// 基于 quic-go 的 task.HTTP3
+type HTTP3 struct{}
+
+// 与 address 完成 QUIC 握手后关闭连接，返回握手耗时
+func (HTTP3) Handshake(ctx context.Context, address string, config *tls.Config) (time.Duration, error) {
+	config = config.Clone()
+	config.NextProtos = []string{nextProto}
+	startTime := time.Now()
+	conn, err := quic.DialAddr(ctx, address, config, nil)
+	if err != nil {
+		return 0, err
+	}
+	duration := time.Since(startTime)
+	_ = conn.CloseWithError(0, "")
+	return duration, nil
+}
+
+// 所有请求均发往 address 的 HTTP/3 Transport，TLS 的 SNI 未指定时使用请求地址的域名
+func (HTTP3) Transport(address string, config *tls.Config) task.RoundTripCloser {
+	return &http3.Transport{
+		TLSClientConfig: config,
+		Dial: func(ctx context.Context, _ string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			return quic.DialAddrEarly(ctx, address, tlsCfg, cfg)
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package h3
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/task"
+	"github.com/quic-go/quic-go/http3"
+)
+
+const testBodySize = 1 << 20
+
+// localhost 的自签名证书
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// 进程内的 HTTP/3 服务器，返回监听的端口及收到的请求数量
+func startTestServer(t *testing.T) (int, chan *http.Request) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("无法监听 UDP 端口：%v", err)
+	}
+	requests := make(chan *http.Request, 10)
+	srv := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{testCertificate(t)}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- r
+			w.Header().Set("CF-RAY", "8a1b2c3d4e5f6789-NRT")
+			w.Header().Set("Content-Length", strconv.Itoa(testBodySize))
+			_, _ = w.Write(make([]byte, testBodySize))
+		}),
+	}
+	go func() { _ = srv.Serve(pc) }()
+	t.Cleanup(func() {
+		_ = srv.Close()
+		_ = pc.Close()
+	})
+	return pc.LocalAddr().(*net.UDPAddr).Port, requests
+}
+
+func TestHandshake(t *testing.T) {
+	port, _ := startTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+
+	delay, err := HTTP3{}.Handshake(ctx, address, &tls.Config{ServerName: "localhost", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("QUIC 握手失败：%v", err)
+	}
+	if delay <= 0 {
+		t.Errorf("握手耗时 = %v", delay)
+	}
+
+	// 未跳过证书验证时，自签名证书应握手失败
+	if _, err = (HTTP3{}).Handshake(ctx, address, &tls.Config{ServerName: "localhost"}); err == nil {
+		t.Error("自签名证书未跳过验证时应握手失败")
+	}
+}
+
+func TestTesterHTTP3(t *testing.T) {
+	port, requests := startTestServer(t)
+	opts := task.DefaultOptions()
+	opts.HTTP3 = true
+	opts.Insecure = true
+	opts.Quiet = true
+	opts.PingTimes = 2
+	opts.IPText = "127.0.0.1"
+	opts.TCPPort = port
+	opts.URL = "https://localhost:" + strconv.Itoa(port) + "/__down"
+	opts.Disable = false
+	opts.MinSpeed = 0
+	opts.Timeout = 2 * time.Second
+	tester, err := task.NewTester(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := tester.Mode(); mode != "http3" {
+		t.Errorf("测速模式 = %q，应为 http3", mode)
+	}
+
+	ctx := context.Background()
+	pingData, err := tester.Ping(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pingData) != 1 || pingData[0].Received != 2 || pingData[0].Delay <= 0 {
+		t.Fatalf("QUIC 延迟测速结果有误：%+v", pingData)
+	}
+
+	speedData, err := tester.TestDownloadSpeed(ctx, pingData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(speedData) != 1 || speedData[0].DownloadSpeed <= 0 {
+		t.Fatalf("HTTP/3 下载测速结果有误：%+v", speedData)
+	}
+	select {
+	case r := <-requests:
+		if r.Proto != "HTTP/3.0" || r.Host != "localhost:"+strconv.Itoa(port) {
+			t.Errorf("请求的协议 = %s，Host = %s", r.Proto, r.Host)
+		}
+	default:
+		t.Error("服务器没有收到下载测速请求")
+	}
+}
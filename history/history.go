@@ -0,0 +1,166 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const (
+	fileExt    = ".jsonl"
+	dateLayout = "2006-01-02"
+
+	typeRun    = "run"
+	typeResult = "result"
+)
+
+// 测速历史记录，保存在指定目录下，每天一个只追加的 JSONL 文件（如 2024-01-02.jsonl），
+// 每次测速先写入一行运行信息 (type=run)，其后每行一个 IP 的测速结果 (type=result)
+type Store struct {
+	Dir  string
+	Keep int // 保留最近几天（含当天）的历史记录文件，为 0 时全部保留
+}
+
+// 一次测速
+type Run struct {
+	Time    time.Time `json:"time"` // 测速开始时间，同时作为该次测速的标识
+	Mode    string    `json:"mode"`
+	Results []Result  `json:"-"`
+}
+
+// 一次测速中单个 IP 的结果
+type Result struct {
+	Time time.Time `json:"time"`
+	Good bool      `json:"good"` // 是否满足测速条件（无丢包且达到下载速度下限）
+	*utils.IPRecord
+}
+
+type runLine struct {
+	Type string `json:"type"`
+	*Run
+	Count int `json:"count"`
+}
+
+type resultLine struct {
+	Type string `json:"type"`
+	*Result
+}
+
+// 追加一次测速的结果，good 判断单个 IP 是否满足测速条件；指定了 Keep 时随后删除过期的历史记录文件
+func (s Store) Append(info *utils.RunInfo, data utils.DownloadSpeedSet, good func(*utils.CloudflareIPData) bool) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("创建历史记录目录 [%s] 失败：%v", s.Dir, err)
+	}
+	var buf bytes.Buffer // 一次写入，避免中途出错留下不完整的测速
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(runLine{typeRun, &Run{Time: info.StartTime, Mode: info.Mode}, len(data)}); err != nil {
+		return err
+	}
+	for i := range data {
+		result := &Result{Time: info.StartTime, Good: good(&data[i]), IPRecord: data[i].ToRecord()}
+		if err := enc.Encode(resultLine{typeResult, result}); err != nil {
+			return err
+		}
+	}
+	path := filepath.Join(s.Dir, info.StartTime.Format(dateLayout)+fileExt)
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开历史记录文件 [%s] 失败：%v", path, err)
+	}
+	defer fp.Close()
+	if _, err = fp.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("写入历史记录文件 [%s] 失败：%v", path, err)
+	}
+	return s.prune(info.StartTime)
+}
+
+// 删除 now 所在日期的 Keep 天之前的历史记录文件（按文件名中的日期判断）
+func (s Store) prune(now time.Time) error {
+	if s.Keep <= 0 {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*"+fileExt))
+	if err != nil {
+		return err
+	}
+	oldest := now.AddDate(0, 0, 1-s.Keep).Format(dateLayout)
+	for _, file := range files {
+		date := strings.TrimSuffix(filepath.Base(file), fileExt)
+		if _, err := time.Parse(dateLayout, date); err != nil || date >= oldest {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("删除过期的历史记录文件 [%s] 失败：%v", file, err)
+		}
+	}
+	return nil
+}
+
+// 读取 since 之后（含当天）的所有测速，按时间排序；无法解析的行（如写入中断）会被跳过
+func (s Store) Load(since time.Time) ([]Run, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*"+fileExt))
+	if err != nil {
+		return nil, err
+	}
+	sinceDate := since.Format(dateLayout)
+	runs := make(map[int64]*Run) // 以开始时间区分各次测速
+	for _, file := range files {
+		date := strings.TrimSuffix(filepath.Base(file), fileExt)
+		if _, err := time.Parse(dateLayout, date); err != nil || date < sinceDate {
+			continue
+		}
+		if err := loadFile(file, runs); err != nil {
+			return nil, fmt.Errorf("读取历史记录文件 [%s] 失败：%v", file, err)
+		}
+	}
+	result := make([]Run, 0, len(runs))
+	for _, run := range runs {
+		if !run.Time.Before(since) {
+			result = append(result, *run)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result, nil
+}
+
+func loadFile(path string, runs map[int64]*Run) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &line) != nil {
+			continue
+		}
+		switch line.Type {
+		case typeRun:
+			run := &Run{}
+			if json.Unmarshal(scanner.Bytes(), run) == nil {
+				runs[run.Time.UnixNano()] = run
+			}
+		case typeResult:
+			result := Result{IPRecord: &utils.IPRecord{}}
+			if json.Unmarshal(scanner.Bytes(), &result) != nil {
+				continue
+			}
+			if run, ok := runs[result.Time.UnixNano()]; ok {
+				run.Results = append(run.Results, result)
+			}
+		}
+	}
+	return scanner.Err()
+}
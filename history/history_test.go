@@ -0,0 +1,179 @@
+package history
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+// 测速结果中的一个 IP，速度单位 MB/s
+type testIP struct {
+	ip    string
+	colo  string
+	delay time.Duration
+	speed float64
+}
+
+func testDate(day, hour, min int) time.Time {
+	return time.Date(2024, 1, day, hour, min, 0, 0, time.Local)
+}
+
+// 满足测速条件即有下载速度
+func appendRun(t *testing.T, s Store, start time.Time, ips ...testIP) {
+	t.Helper()
+	data := make(utils.DownloadSpeedSet, 0, len(ips))
+	for _, v := range ips {
+		data = append(data, utils.CloudflareIPData{
+			PingData:      &utils.PingData{IP: &net.IPAddr{IP: net.ParseIP(v.ip)}, Sended: 4, Received: 4, Delay: v.delay},
+			DownloadSpeed: v.speed * 1024 * 1024,
+			Datacenter:    v.colo,
+		})
+	}
+	good := func(cf *utils.CloudflareIPData) bool { return cf.DownloadSpeed > 0 }
+	if err := s.Append(&utils.RunInfo{Mode: "tcping", StartTime: start}, data, good); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func historyFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 跨越两天的三次测速：1 日 10:00、1 日 23:30 及 2 日 00:30
+func testStore(t *testing.T) Store {
+	t.Helper()
+	s := Store{Dir: filepath.Join(t.TempDir(), "history")}
+	appendRun(t, s, testDate(1, 10, 0),
+		testIP{"1.1.1.1", "NRT", 100 * time.Millisecond, 10},
+		testIP{"2.2.2.2", "HKG", 200 * time.Millisecond, 5})
+	appendRun(t, s, testDate(1, 23, 30),
+		testIP{"1.1.1.1", "NRT", 120 * time.Millisecond, 20},
+		testIP{"2.2.2.2", "HKG", 220 * time.Millisecond, 0},
+		testIP{"3.3.3.3", "NRT", 150 * time.Millisecond, 0})
+	appendRun(t, s, testDate(2, 0, 30),
+		testIP{"1.1.1.1", "NRT", 110 * time.Millisecond, 30},
+		testIP{"3.3.3.3", "NRT", 140 * time.Millisecond, 40})
+	return s
+}
+
+func TestStoreAppendLoad(t *testing.T) {
+	s := testStore(t)
+	if got := strings.Join(historyFiles(t, s.Dir), " "); got != "2024-01-01.jsonl 2024-01-02.jsonl" {
+		t.Fatalf("历史记录文件 = %s，应按天分隔", got)
+	}
+
+	tests := []struct {
+		name  string
+		since time.Time
+		times []time.Time
+	}{
+		{"全部", testDate(1, 0, 0), []time.Time{testDate(1, 10, 0), testDate(1, 23, 30), testDate(2, 0, 30)}},
+		{"当天中途开始", testDate(1, 12, 0), []time.Time{testDate(1, 23, 30), testDate(2, 0, 30)}},
+		{"第二天", testDate(2, 0, 0), []time.Time{testDate(2, 0, 30)}},
+		{"之后没有记录", testDate(3, 0, 0), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, err := s.Load(tt.since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) != len(tt.times) {
+				t.Fatalf("测速次数 = %d，应为 %d", len(runs), len(tt.times))
+			}
+			for i, run := range runs {
+				if !run.Time.Equal(tt.times[i]) || run.Mode != "tcping" {
+					t.Errorf("第 %d 次测速 = %v %s，应为 %v", i+1, run.Time, run.Mode, tt.times[i])
+				}
+			}
+		})
+	}
+
+	runs, _ := s.Load(testDate(1, 0, 0))
+	results := runs[1].Results
+	if len(results) != 3 || results[0].IP != "1.1.1.1" || results[0].Colo != "NRT" || results[0].Delay != 120 ||
+		results[0].DownloadSpeed != 20 || !results[0].Good || results[1].Good {
+		t.Errorf("第 2 次测速的结果有误：%+v %+v", results[0], results[1])
+	}
+}
+
+// 写入中断等原因产生的无法解析的行会被跳过，不影响其他测速
+func TestStoreLoadMalformed(t *testing.T) {
+	s := testStore(t)
+	path := filepath.Join(s.Dir, "2024-01-01.jsonl")
+	fp, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan := testDate(1, 5, 0).Format(time.RFC3339)
+	_, _ = fp.WriteString(strings.Join([]string{
+		"not json",
+		`{"type":"result","time":"` + orphan + `","ip":"9.9.9.9"}`, // 没有对应的测速
+		`{"type":"unknown"}`,
+		`{"type":"run","time":"bad time"}`,
+		`{"type":"result","time":"2024-01-01T10:00:00`, // 写入中断
+	}, "\n"))
+	fp.Close()
+	// 日期无效的文件不会被读取
+	_ = os.WriteFile(filepath.Join(s.Dir, "notes.jsonl"), []byte(`{"type":"run","time":"2024-01-01T11:00:00Z"}`+"\n"), 0644)
+
+	runs, err := s.Load(testDate(1, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 {
+		t.Fatalf("测速次数 = %d，应为 3", len(runs))
+	}
+	for _, run := range runs {
+		for _, r := range run.Results {
+			if r.IP == "9.9.9.9" {
+				t.Error("没有对应测速的结果不应被读取")
+			}
+		}
+	}
+	if n := len(runs[0].Results); n != 2 {
+		t.Errorf("第 1 次测速的结果数量 = %d，应为 2", n)
+	}
+}
+
+// 每次记录后删除 Keep 天（含当天）之前的文件，其他文件不受影响
+func TestStoreRetention(t *testing.T) {
+	tests := []struct {
+		keep  int
+		files string
+	}{
+		{0, "2024-01-01.jsonl 2024-01-02.jsonl 2024-01-03.jsonl 2024-01-04.jsonl notes.jsonl"},
+		{1, "2024-01-04.jsonl notes.jsonl"},
+		{2, "2024-01-03.jsonl 2024-01-04.jsonl notes.jsonl"},
+		{10, "2024-01-01.jsonl 2024-01-02.jsonl 2024-01-03.jsonl 2024-01-04.jsonl notes.jsonl"},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.keep)+" 天", func(t *testing.T) {
+			s := Store{Dir: t.TempDir(), Keep: tt.keep}
+			_ = os.WriteFile(filepath.Join(s.Dir, "notes.jsonl"), nil, 0644)
+			for day := 1; day <= 4; day++ {
+				appendRun(t, s, testDate(day, 12, 0), testIP{"1.1.1.1", "NRT", 100 * time.Millisecond, 10})
+			}
+			if got := strings.Join(historyFiles(t, s.Dir), " "); got != tt.files {
+				t.Errorf("保留 %d 天时的文件 = %s，应为 %s", tt.keep, got, tt.files)
+			}
+		})
+	}
+}
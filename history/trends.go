@@ -0,0 +1,147 @@
+package history
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// 分组方式
+const (
+	ByIP   = "ip"
+	ByColo = "colo"
+)
+
+// 单个 IP（或数据中心）在最近若干次测速中的表现，延迟单位 ms，速度单位 MB/s
+type Trend struct {
+	Key          string     `json:"key"`            // IP 或数据中心
+	Colo         string     `json:"colo,omitempty"` // 按 IP 分组时为最近一次的数据中心
+	Runs         int        `json:"runs"`           // 统计的测速次数
+	Seen         int        `json:"seen"`           // 出现在测速结果中的次数
+	Good         int        `json:"good"`           // 满足测速条件的次数
+	Stability    float64    `json:"stability"`      // 满足测速条件的比例 (Good / Runs)
+	MedianDelay  float64    `json:"median_delay_ms"`
+	MedianSpeed  float64    `json:"median_speed_mb_s"`        // 有下载速度的结果的中位数
+	SpeedCV      float64    `json:"speed_cv"`                 // 下载速度的变异系数（标准差/平均值），越小越稳定
+	LastSeenGood *time.Time `json:"last_seen_good,omitempty"` // 最近一次满足测速条件的时间，从未满足时为 nil
+}
+
+// 统计最近 n 次测速（n <= 0 时为全部）中各 IP 或各数据中心的表现，
+// 最近一次满足测速条件的时间则在所有 runs 中查找；结果按稳定性、中位速度、中位延迟排序
+func Trends(runs []Run, n int, by string) []Trend {
+	recent := runs
+	if n > 0 && len(runs) > n {
+		recent = runs[len(runs)-n:]
+	}
+	key := func(r *Result) string { return r.IP }
+	if by == ByColo {
+		key = func(r *Result) string { return r.Colo }
+	}
+
+	type samples struct {
+		trend  Trend
+		delays []float64
+		speeds []float64
+		runs   map[int64]bool // 按数据中心分组时，同一次测速中多个 IP 只计一次
+		good   map[int64]bool
+	}
+	groups := make(map[string]*samples)
+	get := func(k string) *samples {
+		g, ok := groups[k]
+		if !ok {
+			g = &samples{trend: Trend{Key: k}, runs: make(map[int64]bool), good: make(map[int64]bool)}
+			groups[k] = g
+		}
+		return g
+	}
+	for _, run := range recent {
+		for i := range run.Results {
+			r := &run.Results[i]
+			if key(r) == "" {
+				continue
+			}
+			g := get(key(r))
+			g.runs[run.Time.UnixNano()] = true
+			if r.Good {
+				g.good[run.Time.UnixNano()] = true
+			}
+			if r.Colo != "" {
+				g.trend.Colo = r.Colo
+			}
+			g.delays = append(g.delays, r.Delay)
+			if r.DownloadSpeed > 0 {
+				g.speeds = append(g.speeds, r.DownloadSpeed)
+			}
+		}
+	}
+	for _, run := range runs { // 最近一次满足测速条件的时间不限于最近 n 次
+		for i := range run.Results {
+			r := &run.Results[i]
+			if g, ok := groups[key(r)]; ok && r.Good && (g.trend.LastSeenGood == nil || run.Time.After(*g.trend.LastSeenGood)) {
+				runTime := run.Time
+				g.trend.LastSeenGood = &runTime
+			}
+		}
+	}
+
+	trends := make([]Trend, 0, len(groups))
+	for _, g := range groups {
+		t := g.trend
+		t.Runs, t.Seen, t.Good = len(recent), len(g.runs), len(g.good)
+		t.Stability = float64(t.Good) / float64(t.Runs)
+		t.MedianDelay = median(g.delays)
+		t.MedianSpeed = median(g.speeds)
+		t.SpeedCV = cv(g.speeds)
+		if by == ByColo {
+			t.Colo = ""
+		}
+		trends = append(trends, t)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		a, b := trends[i], trends[j]
+		if a.Stability != b.Stability {
+			return a.Stability > b.Stability
+		}
+		if a.MedianSpeed != b.MedianSpeed {
+			return a.MedianSpeed > b.MedianSpeed
+		}
+		if a.MedianDelay != b.MedianDelay {
+			return a.MedianDelay < b.MedianDelay
+		}
+		return a.Key < b.Key
+	})
+	return trends
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// 变异系数，少于 2 个样本时为 0
+func cv(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if mean == 0 {
+		return 0
+	}
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(variance/float64(len(values))) / mean
+}
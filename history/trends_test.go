@@ -0,0 +1,79 @@
+package history
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+func TestTrends(t *testing.T) {
+	runs, err := testStore(t).Load(testDate(1, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, first := testDate(2, 0, 30), testDate(1, 10, 0)
+	tests := []struct {
+		name string
+		n    int
+		by   string
+		want []Trend
+	}{
+		{"按 IP", 0, ByIP, []Trend{
+			{Key: "1.1.1.1", Colo: "NRT", Runs: 3, Seen: 3, Good: 3, Stability: 1, MedianDelay: 110, MedianSpeed: 20, SpeedCV: math.Sqrt(200.0/3) / 20, LastSeenGood: &last},
+			{Key: "3.3.3.3", Colo: "NRT", Runs: 3, Seen: 2, Good: 1, Stability: 1.0 / 3, MedianDelay: 145, MedianSpeed: 40, LastSeenGood: &last},
+			{Key: "2.2.2.2", Colo: "HKG", Runs: 3, Seen: 2, Good: 1, Stability: 1.0 / 3, MedianDelay: 210, MedianSpeed: 5, LastSeenGood: &first},
+		}},
+		// 同一次测速中同一数据中心的多个 IP 只计一次
+		{"按数据中心", 0, ByColo, []Trend{
+			{Key: "NRT", Runs: 3, Seen: 3, Good: 3, Stability: 1, MedianDelay: 120, MedianSpeed: 25, SpeedCV: math.Sqrt(125) / 25, LastSeenGood: &last},
+			{Key: "HKG", Runs: 3, Seen: 2, Good: 1, Stability: 1.0 / 3, MedianDelay: 210, MedianSpeed: 5, LastSeenGood: &first},
+		}},
+		// 只统计最近 2 次，但最近满足时间在所有测速中查找
+		{"最近 2 次", 2, ByIP, []Trend{
+			{Key: "1.1.1.1", Colo: "NRT", Runs: 2, Seen: 2, Good: 2, Stability: 1, MedianDelay: 115, MedianSpeed: 25, SpeedCV: 0.2, LastSeenGood: &last},
+			{Key: "3.3.3.3", Colo: "NRT", Runs: 2, Seen: 2, Good: 1, Stability: 0.5, MedianDelay: 145, MedianSpeed: 40, LastSeenGood: &last},
+			{Key: "2.2.2.2", Colo: "HKG", Runs: 2, Seen: 1, Good: 0, Stability: 0, MedianDelay: 220, MedianSpeed: 0, LastSeenGood: &first},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Trends(runs, tt.n, tt.by)
+			if len(got) != len(tt.want) {
+				t.Fatalf("结果 = %+v，应有 %d 项", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				g := got[i]
+				if g.Key != want.Key || g.Colo != want.Colo || g.Runs != want.Runs || g.Seen != want.Seen || g.Good != want.Good {
+					t.Errorf("第 %d 项 = %+v\n应为 %+v", i+1, g, want)
+				}
+				for _, f := range []struct {
+					name      string
+					got, want float64
+				}{
+					{"稳定性", g.Stability, want.Stability},
+					{"中位延迟", g.MedianDelay, want.MedianDelay},
+					{"中位速度", g.MedianSpeed, want.MedianSpeed},
+					{"速度波动", g.SpeedCV, want.SpeedCV},
+				} {
+					if math.Abs(f.got-f.want) > 1e-9 {
+						t.Errorf("[%s] 的%s = %v，应为 %v", g.Key, f.name, f.got, f.want)
+					}
+				}
+				if g.LastSeenGood == nil || !g.LastSeenGood.Equal(*want.LastSeenGood) {
+					t.Errorf("[%s] 的最近满足时间 = %v，应为 %v", g.Key, g.LastSeenGood, want.LastSeenGood)
+				}
+			}
+		})
+	}
+}
+
+// 从未满足测速条件时没有最近满足时间
+func TestTrendsNeverGood(t *testing.T) {
+	runs := []Run{{Time: time.Now(), Results: []Result{{Time: time.Now(), IPRecord: &utils.IPRecord{IP: "1.1.1.1", Delay: 100}}}}}
+	got := Trends(runs, 0, ByIP)
+	if len(got) != 1 || got[0].Good != 0 || got[0].LastSeenGood != nil || got[0].MedianSpeed != 0 || got[0].SpeedCV != 0 {
+		t.Errorf("结果 = %+v", got)
+	}
+}
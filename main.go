@@ -1,24 +1,140 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"runtime"
+	"sort"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/XIU2/CloudflareSpeedTest/task"
-	"github.com/XIU2/CloudflareSpeedTest/utils"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/api"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/ddns"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/history"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/metrics"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/task"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
 )
 
 var (
 	version, versionNew string
+
+	testOpts = task.DefaultOptions()        // 测速配置
+	output   = utils.DefaultOutputOptions() // 结果输出配置
+
+	cfDNS        ddns.Cloudflare // Cloudflare 解析记录更新
+	dpDNS        ddns.DNSPod     // DNSPod 解析记录更新
+	hostsFile    ddns.Hosts      // 改写 Hosts 文件
+	dnsProviders []namedProvider // 测速完成后要更新解析记录的服务商
+
+	scheduler *daemon     // 常驻运行，为 nil 时只测速一次
+	apiListen string      // HTTP API 监听地址，为空时不启用
+	apiServer *api.Server // HTTP API
+
+	metricsListen, metricsPush, metricsJob string
+	collector                              *metrics.Collector // Prometheus 指标，为 nil 时不启用
+)
+
+type namedProvider struct {
+	name string
+	ddns.DNSProvider
+}
+
+// 结果文件中敏感信息的替代值
+const redacted = "******"
+
+var (
+	secretFlags = map[string]bool{"cf-token": true, "cf-key": true, "dp-token": true}
+	// 各服务商 [-dns-opt] 中的密钥，webhook 的地址中也常带有令牌
+	secretOptions = map[string]bool{"token": true, "key": true, "key_secret": true, "access_key_secret": true, "secret_key": true, "url": true}
+	secretHeaders = map[string]bool{"Authorization": true, "Proxy-Authorization": true, "Cookie": true}
 )
 
-func init() {
+// 可重复指定的 key=value 参数
+type optionsFlag ddns.Options
+
+func (o optionsFlag) String() string {
+	pairs := make([]string, 0, len(o))
+	for k, v := range o {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// 隐去密钥后的参数值
+func (o optionsFlag) redacted() string {
+	safe := make(optionsFlag, len(o))
+	for k, v := range o {
+		if secretOptions[k] && v != "" {
+			v = redacted
+		}
+		safe[k] = v
+	}
+	return safe.String()
+}
+
+func (o optionsFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("格式应为 key=value：%s", s)
+	}
+	o[strings.TrimSpace(s[:i])] = strings.TrimSpace(s[i+1:])
+	return nil
+}
+
+// 可重复指定的请求头参数，格式为 Name: value
+type headerFlag http.Header
+
+func (h headerFlag) lines() []string {
+	lines := make([]string, 0, len(h))
+	for name, values := range h {
+		for _, v := range values {
+			lines = append(lines, name+": "+v)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func (h headerFlag) String() string {
+	return strings.Join(h.lines(), ",")
+}
+
+func (h headerFlag) Get() interface{} {
+	return h.lines()
+}
+
+// 隐去认证信息后的参数值
+func (h headerFlag) redacted() string {
+	safe := make(headerFlag, len(h))
+	for name, values := range h {
+		if secretHeaders[name] {
+			values = []string{redacted}
+		}
+		safe[name] = values
+	}
+	return safe.String()
+}
+
+func (h headerFlag) Set(s string) error {
+	return task.AddHeader(http.Header(h), s)
+}
+
+// 解析命令行参数及配置文件（在 main 中调用，而不是在 init 中，以免影响测试程序的参数）
+func parseFlags() {
 	var printVersion bool
+	var configPath, dumpFormat string
+	var cfNames, dpSubs, dpLines, dnsName, hostsNames string
+	dnsOpts := make(optionsFlag)
 	var help = `
 CloudflareSpeedTest ` + version + `
 测试 Cloudflare CDN 所有 IP 的延迟和速度，获取最快 IP (IPv4+IPv6)！
@@ -33,6 +149,21 @@ https://github.com/XIU2/CloudflareSpeedTest
         下载测速数量；延迟测速并排序后，从最低延迟起下载测速的数量；(默认 10 个)
     -dt 10
         下载测速时间；单个 IP 下载测速最长时间，不能太短；(默认 10 秒)
+    -dc 1
+        下载测速并发数；同时下载测速的 IP 数量，各 IP 共享本机带宽，带宽不足时测得的速度会偏低；(默认 1 即逐个测速)
+    -dcap
+        测量链路带宽；并发下载测速前先测量单线程及并发的总下载速度，并发会明显拉低单个 IP 速度时给出提示；(默认 关闭)
+    -dconn 4
+        多连接下载测速；每个 IP 单连接下载测速后，再同时建立指定数量的连接下载测速并记录总速度，
+        两者差距明显时说明单连接速度受运营商单流限速影响，而非节点本身较慢；(默认 1 即只测单连接)
+    -uurl https://upload.example.com/upload
+        上传测速地址；下载测速后通过各 IP 向该地址 POST 随机数据测量上传速度，单个 IP 最长时间同 [-dt]；(默认 不进行上传测速)
+    -usize 10
+        上传数据大小；单个 IP 上传测速时上传的数据大小；(默认 10 MB)
+    -usl 2
+        上传速度下限；只输出高于指定上传速度的 IP，没有满足条件的 IP 时输出所有上传测速的 IP；(默认 0.00 MB/s)
+    -usort
+        按上传速度排序；结果改为按上传速度从高到低排序；(默认 按下载速度排序)
     -tp 443
         指定测速端口；延迟测速/下载测速时使用的端口；(默认 443 端口)
     -url https://cf.xiu2.xyz/url
@@ -40,10 +171,42 @@ https://github.com/XIU2/CloudflareSpeedTest
 
     -httping
         切换测速模式；延迟测速模式改为 HTTP 协议，所用测试地址为 [-url] 参数；(默认 TCPing)
-    -httping-code 200
-        有效状态代码；HTTPing 延迟测速时网页返回的有效 HTTP 状态码，仅限一个；(默认 200 301 302)
+    -httping-code 200,204,300-399
+        有效状态代码；HTTPing 延迟测速时网页返回的有效 HTTP 状态码，英文逗号分隔，可为范围；(默认 200 301 302)
+    -httping-header "Server: cloudflare"
+        有效响应头；HTTPing 延迟测速时响应需包含的响应头，格式为 Name: value，响应头的值需包含 value (不区分大小写)，value 为空时只要求存在，可重复指定；(默认 空)
+    -httping-body "cloudflare|ok"
+        有效响应内容；HTTPing 延迟测速时响应内容 (前 64 KB) 需匹配的正则表达式，普通文本即包含该文本，指定后改为 GET 请求；(默认 空)
+    -icmp
+        切换测速模式；延迟测速模式改为 ICMP 协议 (Ping)，需要管理员/root 权限，Linux 下也可通过 ping_group_range 授权普通用户；(默认 TCPing)
+    -tlsping
+        切换测速模式；延迟测速模式改为 TLS 握手，分别记录连接耗时及握手耗时，延迟为两者之和；(默认 TCPing)
+    -http3
+        切换测速模式；延迟测速模式改为 QUIC 握手 (UDP)，下载测速改为 HTTP/3，用于优选 HTTP/3 下较快的 IP，
+        需使用包含 HTTP/3 支持的版本 (构建方法见 h3 目录)；(默认 TCPing)
+    -sni example.com
+        指定 SNI；TLS 延迟测速/HTTPing/下载测速时 TLS 握手使用的服务器名称，需与证书匹配；(默认 [-host]，未指定时为 [-url] 的域名)
+    -host example.com
+        指定 Host 头；HTTPing/下载测速时请求的 Host，用于在共享 IP 上测速自己的域名；(默认 [-url] 的域名)
+    -ua "Mozilla/5.0 ..."
+        指定 User-Agent；HTTPing/下载测速时请求的 User-Agent；(默认 Chrome 浏览器)
+    -header "Referer: https://example.com/"
+        额外的请求头；格式为 Name: value，可重复指定，HTTPing/下载测速时添加到请求中；(默认 空)
+    -insecure
+        跳过证书验证；TLS 延迟测速/HTTPing/下载测速时不校验服务器证书，如自签名证书或 SNI 与证书不匹配时；(默认 校验)
     -cfcolo HKG,KHH,NRT,LAX,SEA,SJC,FRA,MAD
-        匹配指定地区；地区名为当地机场三字码，英文逗号分隔，仅 HTTPing 模式可用；(默认 所有地区)
+        匹配指定地区；地区名为当地机场三字码，英文逗号分隔，非 HTTPing 模式下指定任一筛选条件时自动启用 [-colo-trace]；(默认 所有地区)
+    -cfcountry JP,SG,US
+        匹配指定国家/地区；为两位国家代码，英文逗号分隔，可与 [-cfcolo] [-cfcontinent] 搭配使用（满足其一即可）；(默认 所有国家)
+    -cfcontinent AS,NA
+        匹配指定大洲；可选 AF(非洲) AS(亚洲) EU(欧洲) NA(北美洲) SA(南美洲) OC(大洋洲)，英文逗号分隔；(默认 所有大洲)
+    -cfcolo-exclude HKG,SIN
+        排除指定地区；地区名为当地机场三字码，英文逗号分隔，优先于上面的匹配条件；(默认 不排除)
+    -colo-trace
+        获取数据中心；TCPing/ICMP/TLS/QUIC 模式下额外通过 [-url] 域名的 /cdn-cgi/trace 获取每个 IP 的数据中心；(默认 关闭，指定数据中心筛选条件时开启)
+    -trace
+        获取 trace 信息；测速完成后通过 /cdn-cgi/trace 获取最终结果中各 IP 的数据中心、客户端 IP、HTTP/TLS 版本及 WARP 状态，
+        并追加到结果文件中，用于确认实际提供服务的数据中心及发现透明代理；(默认 关闭)
 
     -tl 200
         平均延迟上限；只输出低于指定平均延迟的 IP，各上下限条件可搭配使用；(默认 9999 ms)
@@ -51,8 +214,29 @@ https://github.com/XIU2/CloudflareSpeedTest
         平均延迟下限；只输出高于指定平均延迟的 IP；(默认 0 ms)
     -tlr 0.2
         丢包几率上限；只输出低于/等于指定丢包率的 IP，范围 0.00~1.00，0 过滤掉任何丢包的 IP；(默认 1.00)
+    -tmax 300
+        最大延迟上限；只输出单次最大延迟低于指定值的 IP；(默认 9999 ms)
+    -tmed 200
+        中位延迟上限；只输出延迟中位数低于指定值的 IP；(默认 9999 ms)
+    -tp95 250
+        P95 延迟上限；只输出 95 分位延迟低于指定值的 IP；(默认 9999 ms)
+    -tj 30
+        延迟抖动上限；只输出抖动 (相邻两次延迟差值的平均值) 低于指定值的 IP；(默认 9999 ms)
+    -tconn 100
+        连接耗时上限；只输出平均 TCP 连接耗时低于指定值的 IP，仅 HTTPing/TLS 模式下有效；(默认 9999 ms)
+    -ttls 150
+        握手耗时上限；只输出平均 TLS 握手耗时低于指定值的 IP，仅 HTTPing/TLS 模式下有效；(默认 9999 ms)
+    -tttfb 200
+        首字节耗时上限；只输出平均首字节耗时 (发送请求后到收到响应首字节) 低于指定值的 IP，仅 HTTPing 模式下有效；(默认 9999 ms)
+    -sort ttfb
+        延迟排序依据；丢包率相同时按指定的平均耗时排序，可选 delay、connect、tls、ttfb，禁用下载测速时即结果顺序；(默认 delay)
     -sl 5
         下载速度下限；只输出高于指定下载速度的 IP，凑够指定数量 [-dn] 才会停止测速；(默认 0.00 MB/s)
+    -score "delay=2,jitter=1,loss=3,download=2,upload=1"
+        综合评分；最终结果（及更新到 DNS 的 IP）改为按评分从高到低排序，可为 指标=权重（英文逗号分隔，各指标归一化后加权）
+        或表达式（如 "download*10 - delay - loss*500"，以原始数值计算，支持 + - * / 及括号）；
+        指标：delay、min_delay、max_delay、median_delay、p95_delay、jitter、loss、connect、tls、ttfb (ms，丢包率为 0~1)，
+        download、multi_download、upload (MB/s)；(默认 不评分)
 
     -p 10
         显示结果数量；测速后直接显示指定数量的结果，为 0 时不显示结果直接退出；(默认 10 个)
@@ -62,6 +246,48 @@ https://github.com/XIU2/CloudflareSpeedTest
         指定IP段数据；直接通过参数指定要测速的 IP 段数据，英文逗号分隔；(默认 空)
     -o result.csv
         写入结果文件；如路径含有空格请加上引号；值为空时不写入文件 [-o ""]；(默认 result.csv)
+    -of json
+        结果文件格式；可选 csv、json、jsonl，JSON/JSONL 包含运行信息且字段名为英文；(默认 按 [-o] 扩展名判断，.json/.jsonl 以外为 csv)
+
+    -cf-zone 023e105f4ecef8ad9ca31a8372d0c353
+        Cloudflare 区域 ID；指定后会在测速完成后以测速结果更新 [-cf-name] 的 A/AAAA 解析记录；(默认 空)
+    -cf-name cdn.example.com,www.example.com
+        Cloudflare 记录名；要更新的完整域名，英文逗号分隔；(默认 空)
+    -cf-token xxx
+        Cloudflare API 令牌；需要 区域.DNS 编辑权限；(默认 空)
+    -cf-email xxx@example.com -cf-key xxx
+        Cloudflare API 密钥；全局 API 密钥方式，需同时指定邮箱和密钥，指定后忽略 [-cf-token]；(默认 空)
+    -cf-num 1
+        解析 IP 数量；使用测速结果中的前几个 IP，多余的同名记录会被删除；(默认 1 个)
+    -cf-ttl 1
+        解析记录 TTL；1 为自动；(默认 1)
+    -cf-proxied
+        开启 Cloudflare 代理；即解析记录的小云朵；(默认 关闭)
+
+    -dp-domain example.com
+        DNSPod 主域名；指定后会在测速完成后以测速结果更新 [-dp-sub] 的 A/AAAA 解析记录；(默认 空)
+    -dp-sub www,cdn
+        DNSPod 主机记录；英文逗号分隔，@ 表示主域名本身；(默认 空)
+    -dp-token 12345,xxx
+        DNSPod API Token；格式为 ID,Token；(默认 空)
+    -dp-line 默认,电信,联通
+        DNSPod 记录线路；英文逗号分隔，每条线路分别解析；(默认 默认)
+    -dp-num 1
+        解析 IP 数量；使用测速结果中的前几个 IP，多余的同名同线路记录会被删除；(默认 1 个)
+    -dp-ttl 600
+        解析记录 TTL；(默认 600)
+
+    -hosts cdn.example.com,www.example.com
+        改写 Hosts 文件；测速完成后将指定域名指向优选 IP，只改写文件中由本程序管理的段落，改写前会备份为 .cfst.bak；(默认 空)
+    -hosts-file /etc/hosts
+        Hosts 文件路径；(默认 系统 Hosts 文件)
+    -hosts-num 1
+        Hosts 使用 IP 数量；大于 1 时各域名依次轮流分配测速结果中的前几个 IP；(默认 1 个)
+
+    -dns rfc2136
+        解析服务商；指定后会在测速完成后以测速结果更新解析记录，可选 alidns、cloudflare、dnspod、huaweicloud、rfc2136、hosts、webhook；(默认 空)
+    -dns-opt server=127.0.0.1:53 -dns-opt zone=example.com -dns-opt name=cdn.example.com
+        服务商配置项；格式为 key=value，可重复指定，各服务商的配置项见 ddns 目录下对应源码；(默认 空)
 
     -dd
         禁用下载测速；禁用后测速结果会按延迟排序 (默认按下载速度排序)；(默认 启用)
@@ -83,58 +309,247 @@ https://github.com/XIU2/CloudflareSpeedTest
     -v6
         指定 IPv6 测试数量 (2^n±m，例如 -v6 18-6 表示 2^18-6 即每个 CIDR 测速 262138 个)
 
+    -interval 30m
+        常驻运行间隔；指定后程序不退出，每次测速结束后等待指定时间再次测速，支持 s/m/h 单位；(默认 0 即只测速一次)
+    -cron "0 */6 * * *"
+        常驻运行计划；以 cron 表达式 (分 时 日 月 周) 指定测速时间，启动后会先测速一次，不能与 [-interval] 同时使用；(默认 空)
+    -hysteresis 10
+        切换阈值；常驻运行时只有最优 IP 变化，且新 IP 的下载速度比当前使用的 IP 高 (指定 [-score] 时为综合评分，指定 [-usort] 时为上传速度，禁用下载测速时为延迟低) 指定百分比以上才会更新解析记录/Hosts/Webhook；(默认 10 %)
+
+    -api 127.0.0.1:8080
+        启用 HTTP API；监听指定地址，可通过 API 发起测速、查询进度、获取测速结果及历史记录，启用后程序不退出，建议只监听 127.0.0.1；(默认 空)
+
+    -metrics 127.0.0.1:9101
+        Prometheus 指标；常驻运行 ([-interval]/[-cron]/[-api]) 时监听指定地址提供 /metrics，包括每个 IP 的延迟/丢包/速度/评分/数据中心、测速耗时、IP 数量及当前带宽；(默认 空)
+    -metrics-push http://127.0.0.1:9091
+        推送指标；每次测速结束后将指标推送到指定的 Pushgateway，单次测速时也可使用；(默认 空)
+    -metrics-job cfst
+        推送指标的 job 名称；(默认 cfst)
+
+    -history history
+        记录测速历史；每次测速后将结果追加到指定目录下按天分隔的 JSONL 文件中，
+        可通过 [cfst trends] 子命令查询各 IP/数据中心的历史表现 (详见 cfst trends -h)；(默认 空 即不记录)
+    -history-keep 90
+        历史记录保留天数；每次记录后删除更早的历史记录文件 (含当天共保留指定天数)；(默认 0 即全部保留)
+
+    -config cfst.yaml
+        指定配置文件；支持 YAML、TOML、JSON (按扩展名判断)，命令行中指定的参数优先于配置文件；(默认 空)
+    -dump-config yaml
+        输出实际配置；以指定格式 (yaml/toml/json) 输出合并配置文件与命令行参数后的配置，然后退出；(默认 空)
+
     -v
         打印程序版本 + 检查版本更新
     -h
         打印帮助说明
 `
-	var minDelay, maxDelay, downloadTime int
+	var minDelay, maxDelay, downloadTime, uploadSize int
+	var maxPeakDelay, maxMedianDelay, maxP95Delay, maxJitter int
+	var maxConnectDelay, maxTLSDelay, maxTTFB int
 	var maxLossRate float64
-	flag.IntVar(&task.Routines, "n", 200, "延迟测速线程")
-	flag.IntVar(&task.PingTimes, "t", 4, "延迟测速次数")
-	flag.IntVar(&task.TestCount, "dn", 10, "下载测速数量")
+	var many4, some6, many6, lots6, more6 bool
+	flag.IntVar(&testOpts.Routines, "n", 200, "延迟测速线程")
+	flag.IntVar(&testOpts.PingTimes, "t", 4, "延迟测速次数")
+	flag.IntVar(&testOpts.TestCount, "dn", 10, "下载测速数量")
 	flag.IntVar(&downloadTime, "dt", 10, "下载测速时间")
-	flag.IntVar(&task.TCPPort, "tp", 443, "指定测速端口")
-	flag.StringVar(&task.URL, "url", "https://cf.xiu2.xyz/url", "指定测速地址")
+	flag.IntVar(&testOpts.DownloadRoutines, "dc", 1, "下载测速并发数")
+	flag.BoolVar(&testOpts.TestCapacity, "dcap", false, "测量链路带宽")
+	flag.IntVar(&testOpts.Connections, "dconn", 1, "多连接下载测速")
+	flag.StringVar(&testOpts.UploadURL, "uurl", "", "上传测速地址")
+	flag.IntVar(&uploadSize, "usize", 10, "上传数据大小")
+	flag.Float64Var(&testOpts.MinUploadSpeed, "usl", 0, "上传速度下限")
+	flag.BoolVar(&testOpts.SortByUpload, "usort", false, "按上传速度排序")
+	flag.IntVar(&testOpts.TCPPort, "tp", 443, "指定测速端口")
+	flag.StringVar(&testOpts.URL, "url", "https://cf.xiu2.xyz/url", "指定测速地址")
 
-	flag.BoolVar(&task.Httping, "httping", false, "切换测速模式")
-	flag.IntVar(&task.HttpingStatusCode, "httping-code", 0, "有效状态代码")
-	flag.StringVar(&task.HttpingCFColo, "cfcolo", "", "匹配指定地区")
+	flag.BoolVar(&testOpts.Httping, "httping", false, "切换测速模式")
+	flag.StringVar(&testOpts.HttpingStatusCode, "httping-code", "", "有效状态代码")
+	testOpts.HttpingHeaders = make(http.Header)
+	flag.Var(headerFlag(testOpts.HttpingHeaders), "httping-header", "有效响应头")
+	flag.StringVar(&testOpts.HttpingBody, "httping-body", "", "有效响应内容")
+	flag.BoolVar(&testOpts.ICMP, "icmp", false, "切换测速模式")
+	flag.BoolVar(&testOpts.TLSPing, "tlsping", false, "切换测速模式")
+	flag.BoolVar(&testOpts.HTTP3, "http3", false, "切换测速模式")
+	flag.StringVar(&testOpts.SNI, "sni", "", "指定 SNI")
+	flag.StringVar(&testOpts.Host, "host", "", "指定 Host 头")
+	flag.StringVar(&testOpts.UserAgent, "ua", "", "指定 User-Agent")
+	testOpts.Headers = make(http.Header)
+	flag.Var(headerFlag(testOpts.Headers), "header", "额外的请求头")
+	flag.BoolVar(&testOpts.Insecure, "insecure", false, "跳过证书验证")
+	flag.StringVar(&testOpts.HttpingCFColo, "cfcolo", "", "匹配指定地区")
+	flag.StringVar(&testOpts.ColoCountries, "cfcountry", "", "匹配指定国家/地区")
+	flag.StringVar(&testOpts.ColoContinents, "cfcontinent", "", "匹配指定大洲")
+	flag.StringVar(&testOpts.ColoExclude, "cfcolo-exclude", "", "排除指定地区")
+	flag.BoolVar(&testOpts.ColoTrace, "colo-trace", false, "获取数据中心")
+	flag.BoolVar(&testOpts.Trace, "trace", false, "获取 trace 信息")
 
 	flag.IntVar(&maxDelay, "tl", 9999, "平均延迟上限")
 	flag.IntVar(&minDelay, "tll", 0, "平均延迟下限")
 	flag.Float64Var(&maxLossRate, "tlr", 1, "丢包几率上限")
-	flag.Float64Var(&task.MinSpeed, "sl", 0, "下载速度下限")
-
-	flag.IntVar(&utils.PrintNum, "p", 10, "显示结果数量")
-	flag.StringVar(&task.IPFile, "f", "ip.txt", "IP段数据文件")
-	flag.StringVar(&task.IPText, "ip", "", "指定IP段数据")
-	flag.StringVar(&utils.Output, "o", "result.csv", "输出结果文件")
-
-	flag.BoolVar(&task.Disable, "dd", false, "禁用下载测速")
-	flag.BoolVar(&task.TestAll4, "all4", false, "测速全部的 IPv4")
-	flag.BoolVar(&task.More6, "more6", false, "测试更多 IPv6 (2^18 个)")
-	flag.BoolVar(&task.Lots6, "lots6", false, "测试较多 IPv6 (2^16 个)")
-	flag.BoolVar(&task.Many6, "many6", false, "测试很多 IPv6 (2^12 个)")
-	flag.BoolVar(&task.Some6, "some6", false, "测试一些 IPv6 (2^8 个)")
-	flag.BoolVar(&task.Many4, "many4", false, "测试一点 IPv4 (2^12 个)")
+	flag.IntVar(&maxPeakDelay, "tmax", 9999, "最大延迟上限")
+	flag.IntVar(&maxMedianDelay, "tmed", 9999, "中位延迟上限")
+	flag.IntVar(&maxP95Delay, "tp95", 9999, "P95 延迟上限")
+	flag.IntVar(&maxJitter, "tj", 9999, "延迟抖动上限")
+	flag.IntVar(&maxConnectDelay, "tconn", 9999, "连接耗时上限")
+	flag.IntVar(&maxTLSDelay, "ttls", 9999, "握手耗时上限")
+	flag.IntVar(&maxTTFB, "tttfb", 9999, "首字节耗时上限")
+	flag.StringVar(&testOpts.SortBy, "sort", utils.SortDelay, "延迟排序依据")
+	flag.StringVar(&testOpts.Score, "score", "", "综合评分")
+	flag.Float64Var(&testOpts.MinSpeed, "sl", 0, "下载速度下限")
+
+	flag.IntVar(&output.PrintNum, "p", 10, "显示结果数量")
+	flag.StringVar(&testOpts.IPFile, "f", "ip.txt", "IP段数据文件")
+	flag.StringVar(&testOpts.IPText, "ip", "", "指定IP段数据")
+	flag.StringVar(&output.File, "o", "result.csv", "输出结果文件")
+	flag.StringVar(&output.Format, "of", "", "结果文件格式")
+
+	flag.StringVar(&cfDNS.APIBase, "cf-api", "", "Cloudflare API 地址")
+	flag.StringVar(&cfDNS.ZoneID, "cf-zone", "", "Cloudflare 区域 ID")
+	flag.StringVar(&cfNames, "cf-name", "", "Cloudflare 记录名")
+	flag.StringVar(&cfDNS.Token, "cf-token", "", "Cloudflare API 令牌")
+	flag.StringVar(&cfDNS.Email, "cf-email", "", "Cloudflare 账户邮箱")
+	flag.StringVar(&cfDNS.Key, "cf-key", "", "Cloudflare 全局 API 密钥")
+	flag.IntVar(&cfDNS.Count, "cf-num", 1, "解析 IP 数量")
+	flag.IntVar(&cfDNS.TTL, "cf-ttl", 1, "解析记录 TTL")
+	flag.BoolVar(&cfDNS.Proxied, "cf-proxied", false, "开启 Cloudflare 代理")
+
+	flag.StringVar(&dpDNS.APIBase, "dp-api", "", "DNSPod API 地址")
+	flag.StringVar(&dpDNS.Domain, "dp-domain", "", "DNSPod 主域名")
+	flag.StringVar(&dpSubs, "dp-sub", "", "DNSPod 主机记录")
+	flag.StringVar(&dpDNS.Token, "dp-token", "", "DNSPod API Token")
+	flag.StringVar(&dpLines, "dp-line", "", "DNSPod 记录线路")
+	flag.IntVar(&dpDNS.Count, "dp-num", 1, "解析 IP 数量")
+	flag.IntVar(&dpDNS.TTL, "dp-ttl", 600, "解析记录 TTL")
+
+	flag.StringVar(&hostsNames, "hosts", "", "改写 Hosts 文件")
+	flag.StringVar(&hostsFile.Path, "hosts-file", "", "Hosts 文件路径")
+	flag.IntVar(&hostsFile.Count, "hosts-num", 1, "Hosts 使用 IP 数量")
+
+	flag.StringVar(&dnsName, "dns", "", "解析服务商")
+	flag.Var(dnsOpts, "dns-opt", "服务商配置项")
+
+	flag.BoolVar(&testOpts.Disable, "dd", false, "禁用下载测速")
+	flag.BoolVar(&testOpts.TestAll4, "all4", false, "测速全部的 IPv4")
+	flag.BoolVar(&more6, "more6", false, "测试更多 IPv6 (2^18 个)")
+	flag.BoolVar(&lots6, "lots6", false, "测试较多 IPv6 (2^16 个)")
+	flag.BoolVar(&many6, "many6", false, "测试很多 IPv6 (2^12 个)")
+	flag.BoolVar(&some6, "some6", false, "测试一些 IPv6 (2^8 个)")
+	flag.BoolVar(&many4, "many4", false, "测试一点 IPv4 (2^12 个)")
 	
 	var v4TestNum, v6TestNum string
 	flag.StringVar(&v4TestNum, "v4", "", "指定 IPv4 测试数量")
 	flag.StringVar(&v6TestNum, "v6", "", "指定 IPv6 测试数量")
 	
+	var interval time.Duration
+	var cronExpr string
+	var hysteresis float64
+	flag.DurationVar(&interval, "interval", 0, "常驻运行间隔")
+	flag.StringVar(&cronExpr, "cron", "", "常驻运行计划")
+	flag.Float64Var(&hysteresis, "hysteresis", 10, "切换阈值")
+
+	flag.StringVar(&apiListen, "api", "", "启用 HTTP API")
+
+	flag.StringVar(&metricsListen, "metrics", "", "Prometheus 指标")
+	flag.StringVar(&metricsPush, "metrics-push", "", "推送指标")
+	flag.StringVar(&metricsJob, "metrics-job", "cfst", "推送指标的 job 名称")
+
+	var historyDir string
+	var historyKeep int
+	flag.StringVar(&historyDir, "history", "", "记录测速历史")
+	flag.IntVar(&historyKeep, "history-keep", 0, "历史记录保留天数")
+
+	flag.StringVar(&configPath, "config", "", "指定配置文件")
+	flag.StringVar(&dumpFormat, "dump-config", "", "输出实际配置")
+
 	flag.BoolVar(&printVersion, "v", false, "打印程序版本")
 	flag.Usage = func() { fmt.Print(help) }
 	flag.Parse()
 
-	if task.MinSpeed > 0 && time.Duration(maxDelay)*time.Millisecond == utils.InputMaxDelay {
+	var dnsList []ddns.Options // 配置文件及命令行中指定的解析服务商
+	if configPath != "" {
+		var err error
+		if dnsList, err = loadConfig(flag.CommandLine, configPath); err != nil {
+			log.Fatalf("[错误] 读取配置文件 [%s] 失败：%v", configPath, err)
+		}
+	}
+	if dnsName != "" {
+		opts := ddns.Options{"provider": dnsName}
+		for k, v := range dnsOpts {
+			opts[k] = v
+		}
+		dnsList = append(dnsList, opts)
+	}
+	if dumpFormat != "" {
+		if err := dumpConfig(flag.CommandLine, os.Stdout, dumpFormat, dnsList); err != nil {
+			log.Fatalf("[错误] 输出配置失败：%v", err)
+		}
+		os.Exit(0)
+	}
+
+	modes := 0
+	for _, mode := range []bool{testOpts.Httping, testOpts.ICMP, testOpts.TLSPing, testOpts.HTTP3} {
+		if mode {
+			modes++
+		}
+	}
+	if modes > 1 {
+		log.Fatalf("[错误] [-httping]、[-icmp]、[-tlsping]、[-http3] 只能指定其中一个")
+	}
+	if testOpts.MinSpeed > 0 && time.Duration(maxDelay)*time.Millisecond == testOpts.Filter.MaxDelay {
 		fmt.Println("[小提示] 在使用 [-sl] 参数时，建议搭配 [-tl] 参数，以避免因凑不够 [-dn] 数量而一直测速...")
 	}
-	utils.InputMaxDelay = time.Duration(maxDelay) * time.Millisecond
-	utils.InputMinDelay = time.Duration(minDelay) * time.Millisecond
-	utils.InputMaxLossRate = float32(maxLossRate)
-	task.Timeout = time.Duration(downloadTime) * time.Second
-	task.HttpingCFColomap = task.MapColoMap()
+	testOpts.Filter.MaxDelay = time.Duration(maxDelay) * time.Millisecond
+	testOpts.Filter.MinDelay = time.Duration(minDelay) * time.Millisecond
+	testOpts.Filter.MaxLossRate = float32(maxLossRate)
+	testOpts.Filter.MaxPeakDelay = time.Duration(maxPeakDelay) * time.Millisecond
+	testOpts.Filter.MaxMedianDelay = time.Duration(maxMedianDelay) * time.Millisecond
+	testOpts.Filter.MaxP95Delay = time.Duration(maxP95Delay) * time.Millisecond
+	testOpts.Filter.MaxJitter = time.Duration(maxJitter) * time.Millisecond
+	testOpts.Filter.MaxConnectDelay = time.Duration(maxConnectDelay) * time.Millisecond
+	testOpts.Filter.MaxTLSDelay = time.Duration(maxTLSDelay) * time.Millisecond
+	testOpts.Filter.MaxTTFB = time.Duration(maxTTFB) * time.Millisecond
+	if err := task.CheckOptions(testOpts); err != nil {
+		log.Fatalf("[错误] %v", err)
+	}
+	if err := output.Check(); err != nil {
+		log.Fatalf("[错误] %v", err)
+	}
+	testOpts.Timeout = time.Duration(downloadTime) * time.Second
+	testOpts.UploadSize = int64(uploadSize) * 1024 * 1024
+	cfDNS.Names = ddns.SplitList(cfNames)
+	dpDNS.SubDomains = ddns.SplitList(dpSubs)
+	dpDNS.Lines = ddns.SplitList(dpLines)
+	if cfDNS.ZoneID != "" && len(cfDNS.Names) > 0 {
+		dnsProviders = append(dnsProviders, namedProvider{"Cloudflare", &cfDNS})
+	}
+	if dpDNS.Domain != "" && len(dpDNS.SubDomains) > 0 {
+		dnsProviders = append(dnsProviders, namedProvider{"DNSPod", &dpDNS})
+	}
+	if hostsFile.Names = ddns.SplitList(hostsNames); len(hostsFile.Names) > 0 {
+		dnsProviders = append(dnsProviders, namedProvider{"Hosts", &hostsFile})
+	}
+	for _, opts := range dnsList {
+		name := opts.String("provider")
+		provider, err := ddns.New(name, opts)
+		if err != nil {
+			log.Fatalf("[错误] 解析服务商 [%s] 配置有误：%v", name, err)
+		}
+		dnsProviders = append(dnsProviders, namedProvider{name, provider})
+	}
+
+	if historyDir != "" {
+		historyStore = &history.Store{Dir: historyDir, Keep: historyKeep}
+	}
+
+	var err error
+	if scheduler, err = newDaemon(interval, cronExpr, hysteresis); err != nil {
+		log.Fatalf("[错误] %v", err)
+	}
+	if metricsListen != "" || metricsPush != "" {
+		collector = &metrics.Collector{}
+		if metricsListen != "" && scheduler == nil && apiListen == "" {
+			fmt.Println("[小提示] [-metrics] 参数仅在常驻运行时有效，单次测速请使用 [-metrics-push] 参数推送指标...")
+		}
+	}
 
 	if printVersion {
 		println(version)
@@ -150,35 +565,87 @@ https://github.com/XIU2/CloudflareSpeedTest
 
 	// 处理测试数量
 	if v4TestNum != "" {
-		task.IPv4TestNum = task.ParseTestNum(v4TestNum, true)
-	} else if task.Many4 {
-		task.IPv4TestNum = 4096 // 2^12
+		testOpts.IPv4TestNum = task.ParseTestNum(v4TestNum, true)
+	} else if many4 {
+		testOpts.IPv4TestNum = 4096 // 2^12
 	}
 
 	if v6TestNum != "" {
-		task.IPv6TestNum = task.ParseTestNum(v6TestNum, false)
-	} else if task.Some6 {
-		task.IPv6TestNum = 256 // 2^8
-	} else if task.Many6 {
-		task.IPv6TestNum = 4096 // 2^12
-	} else if task.Lots6 {
-		task.IPv6TestNum = 65536 // 2^16
-	} else if task.More6 {
-		task.IPv6TestNum = 262144 // 2^18
+		testOpts.IPv6TestNum = task.ParseTestNum(v6TestNum, false)
+	} else if some6 {
+		testOpts.IPv6TestNum = 256 // 2^8
+	} else if many6 {
+		testOpts.IPv6TestNum = 4096 // 2^12
+	} else if lots6 {
+		testOpts.IPv6TestNum = 65536 // 2^16
+	} else if more6 {
+		testOpts.IPv6TestNum = 262144 // 2^18
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == trendsCommand {
+		runTrends(os.Args[2:])
+		return
+	}
+	parseFlags()
 	task.InitRandSeed() // 置随机数种子
 
 	fmt.Printf("# XIU2/CloudflareSpeedTest %s \n\n", version)
 
-	// 开始延迟测速 + 过滤延迟/丢包
-	pingData := task.NewPing().Run().FilterDelay().FilterLossRate()
-	// 开始下载测速
-	speedData := task.TestDownloadSpeed(pingData)
-	utils.ExportCsv(speedData) // 输出文件
-	speedData.Print()          // 打印结果
+	ctx := context.Background()
+	tester, err := task.NewTester(testOpts)
+	if err != nil {
+		log.Fatalf("[错误] %v", err)
+	}
+	if scheduler != nil || apiListen != "" { // 常驻运行，收到 Ctrl+C 或 SIGTERM 时中止测速并退出
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if apiListen != "" {
+			apiServer = &api.Server{Base: testOpts}
+			if collector != nil { // 通过 API 发起的测速同样记录指标
+				apiServer.OnStart = collector.SetTester
+				apiServer.OnFinish = func(tester *task.Tester, data utils.DownloadSpeedSet, start, end time.Time, err error) {
+					pushMetrics(tester, data, &utils.RunInfo{StartTime: start, EndTime: end}, err)
+				}
+			}
+			go func() {
+				if err := apiServer.ListenAndServe(ctx, apiListen); err != nil {
+					log.Fatalf("[错误] HTTP API 启动失败：%v", err)
+				}
+			}()
+			fmt.Printf("HTTP API 已启动：http://%s/api/runs\n\n", apiListen)
+		}
+		if metricsListen != "" {
+			go func() {
+				if err := collector.ListenAndServe(ctx, metricsListen); err != nil {
+					log.Fatalf("[错误] Prometheus 指标服务启动失败：%v", err)
+				}
+			}()
+			fmt.Printf("Prometheus 指标：http://%s/metrics\n\n", metricsListen)
+		}
+		if scheduler != nil {
+			scheduler.run(ctx, tester)
+		} else {
+			<-ctx.Done()
+		}
+		fmt.Println("\n[信息] 已停止运行。")
+		return
+	}
+	info := &utils.RunInfo{Version: version, Mode: tester.Mode(), StartTime: time.Now(), Params: flagParams()}
+	// 延迟测速 + 过滤延迟/丢包/延迟分布 + 下载测速
+	speedData, err := tester.Run(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	info.EndTime = time.Now()
+	if err := output.Export(speedData, info); err != nil { // 输出文件
+		log.Fatal(err)
+	}
+	recordHistory(speedData, info, tester.Options()) // 记录测速历史
+	speedData.Print(output)                          // 打印结果
+	_ = publish(speedData)                           // 更新解析记录（各记录的结果已输出）
+	pushMetrics(tester, speedData, info, nil)        // 推送指标
 
 	if versionNew != "" {
 		fmt.Printf("\n*** 发现新版本 [%s]！请前往 [https://github.com/XIU2/CloudflareSpeedTest] 更新！ ***\n", versionNew)
@@ -186,8 +653,65 @@ func main() {
 	endPrint()
 }
 
+// 以测速结果更新各服务商的解析记录，有记录更新失败时返回错误（各记录的结果已输出）
+func publish(speedData utils.DownloadSpeedSet) error {
+	var failed []string
+	for _, p := range dnsProviders {
+		results := p.Publish(speedData)
+		ddns.PrintResults(p.name, results)
+		for _, r := range results {
+			if r.Err != nil {
+				failed = append(failed, p.name)
+				break
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("更新 %s 解析记录失败", strings.Join(failed, "、"))
+	}
+	return nil
+}
+
+// 记录本次测速的指标，并推送到 Pushgateway
+func pushMetrics(tester *task.Tester, speedData utils.DownloadSpeedSet, info *utils.RunInfo, err error) {
+	if collector == nil {
+		return
+	}
+	collector.Observe(tester, speedData, info.StartTime, info.EndTime, err)
+	if metricsPush == "" {
+		return
+	}
+	if err := collector.Push(metricsPush, metricsJob); err != nil {
+		log.Printf("[错误] 推送指标失败：%v", err)
+	}
+}
+
+// 所有参数的实际值（含默认值），写入 JSON/JSONL 结果文件的运行信息中，密钥等敏感信息会被隐去
+func flagParams() map[string]string {
+	params := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch v := f.Value.(type) {
+		case optionsFlag:
+			value = v.redacted()
+		case headerFlag:
+			value = v.redacted()
+		default:
+			if secretFlags[f.Name] && value != "" {
+				value = redacted
+			} else if f.Name == "metrics-push" {
+				if u, err := url.Parse(value); err == nil {
+					value = u.Redacted() // 隐去地址中的密码
+				}
+			}
+		}
+		params[f.Name] = value
+	})
+	return params
+}
+
 func endPrint() {
-	if utils.NoPrintResult() {
+	if output.NoPrintResult() {
 		return
 	}
 	if runtime.GOOS == "windows" { // 如果是 Windows 系统，则需要按下 回车键 或 Ctrl+C 退出（避免通过双击运行时，测速完毕后直接关闭）
@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/task"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const (
+	contentType     = "text/plain; version=0.0.4; charset=utf-8"
+	requestTimeout  = 10 * time.Second
+	shutdownTimeout = 5 * time.Second
+)
+
+// 以 Prometheus 文本格式输出测速指标，可供拉取 (/metrics) 或推送到 Pushgateway
+type Collector struct {
+	mu        sync.Mutex
+	tester    *task.Tester // 正在使用的测速器，用于获取实时进度及带宽
+	data      utils.DownloadSpeedSet
+	progress  task.Progress
+	durations map[string]time.Duration
+	start     time.Time
+	end       time.Time
+	runs      int
+	failures  int
+}
+
+// 设置正在使用的测速器，抓取时会输出其实时进度及带宽
+func (c *Collector) SetTester(tester *task.Tester) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tester = tester
+}
+
+// 记录一次测速的结果，测速失败或没有可用 IP 时保留上一次的测速结果
+func (c *Collector) Observe(tester *task.Tester, data utils.DownloadSpeedSet, start, end time.Time, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.runs++
+	c.progress = tester.Progress()
+	c.durations = tester.StageDurations()
+	c.start, c.end = start, end
+	if err != nil || len(data) == 0 {
+		c.failures++
+		return
+	}
+	c.data = data
+}
+
+// 写入所有指标
+func (c *Collector) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := &writer{}
+
+	progress := c.progress
+	if c.tester != nil {
+		progress = c.tester.Progress()
+	}
+	m.help("cfst_runs_total", "counter", "测速次数")
+	m.sample("cfst_runs_total", nil, float64(c.runs))
+	m.help("cfst_run_failures_total", "counter", "测速失败或没有可用 IP 的次数")
+	m.sample("cfst_run_failures_total", nil, float64(c.failures))
+	m.help("cfst_bandwidth_bytes_per_second", "gauge", "当前下载测速的速度 (B/s)")
+	m.sample("cfst_bandwidth_bytes_per_second", nil, progress.Bandwidth*1024*1024)
+	m.help("cfst_ips_probed", "gauge", "延迟测速的 IP 数量")
+	m.sample("cfst_ips_probed", nil, float64(progress.Probed))
+	m.help("cfst_ips_available", "gauge", "延迟测速可用的 IP 数量")
+	m.sample("cfst_ips_available", nil, float64(progress.Available))
+
+	if c.runs > 0 {
+		m.help("cfst_last_run_timestamp_seconds", "gauge", "最近一次测速结束的时间")
+		m.sample("cfst_last_run_timestamp_seconds", nil, float64(c.end.UnixNano())/1e9)
+		m.help("cfst_last_run_duration_seconds", "gauge", "最近一次测速的总耗时")
+		m.sample("cfst_last_run_duration_seconds", nil, c.end.Sub(c.start).Seconds())
+		m.help("cfst_stage_duration_seconds", "gauge", "最近一次测速各阶段的耗时")
+		stages := make([]string, 0, len(c.durations))
+		for stage := range c.durations {
+			stages = append(stages, stage)
+		}
+		sort.Strings(stages)
+		for _, stage := range stages {
+			m.sample("cfst_stage_duration_seconds", []string{"stage", stage}, c.durations[stage].Seconds())
+		}
+	}
+
+	if len(c.data) > 0 {
+		best := c.data[0]
+		m.help("cfst_best_delay_seconds", "gauge", "最优 IP 的平均延迟")
+		m.sample("cfst_best_delay_seconds", ipLabels(&best), best.Delay.Seconds())
+		m.help("cfst_best_download_speed_bytes_per_second", "gauge", "最优 IP 的下载速度 (B/s)")
+		m.sample("cfst_best_download_speed_bytes_per_second", ipLabels(&best), best.DownloadSpeed)
+	}
+	// optional 的指标只有测速了（有 IP 的值不为 0）时才输出
+	ipMetrics := []struct {
+		name, help string
+		value      func(i int, cf *utils.CloudflareIPData) float64
+		optional   bool
+	}{
+		{"cfst_ip_rank", "IP 在测速结果中的排名，1 为最优", func(i int, cf *utils.CloudflareIPData) float64 { return float64(i + 1) }, false},
+		{"cfst_ip_delay_seconds", "平均延迟", func(i int, cf *utils.CloudflareIPData) float64 { return cf.Delay.Seconds() }, false},
+		{"cfst_ip_min_delay_seconds", "最小延迟", func(i int, cf *utils.CloudflareIPData) float64 { return cf.MinDelay.Seconds() }, false},
+		{"cfst_ip_max_delay_seconds", "最大延迟", func(i int, cf *utils.CloudflareIPData) float64 { return cf.MaxDelay.Seconds() }, false},
+		{"cfst_ip_median_delay_seconds", "中位延迟", func(i int, cf *utils.CloudflareIPData) float64 { return cf.MedianDelay.Seconds() }, false},
+		{"cfst_ip_p95_delay_seconds", "P95 延迟", func(i int, cf *utils.CloudflareIPData) float64 { return cf.P95Delay.Seconds() }, false},
+		{"cfst_ip_jitter_seconds", "延迟抖动", func(i int, cf *utils.CloudflareIPData) float64 { return cf.Jitter.Seconds() }, false},
+		{"cfst_ip_loss_ratio", "丢包率", func(i int, cf *utils.CloudflareIPData) float64 { return cf.ToRecord().LossRate }, false},
+		{"cfst_ip_download_speed_bytes_per_second", "下载速度 (B/s)", func(i int, cf *utils.CloudflareIPData) float64 { return cf.DownloadSpeed }, false},
+		{"cfst_ip_multi_download_speed_bytes_per_second", "多连接同时下载的总速度 (B/s)", func(i int, cf *utils.CloudflareIPData) float64 { return cf.MultiSpeed }, true},
+		{"cfst_ip_upload_speed_bytes_per_second", "上传速度 (B/s)", func(i int, cf *utils.CloudflareIPData) float64 { return cf.UploadSpeed }, true},
+	}
+	for _, im := range ipMetrics {
+		if len(c.data) == 0 || im.optional && !c.hasValue(im.value) {
+			continue
+		}
+		m.help(im.name, "gauge", im.help)
+		for i := range c.data {
+			m.sample(im.name, ipLabels(&c.data[i]), im.value(i, &c.data[i]))
+		}
+	}
+	scored := false // 指定了 [-score] 时才有综合评分，评分无效（如除以 0）的 IP 不输出
+	for i := range c.data {
+		record := c.data[i].ToRecord()
+		if record.Score == nil {
+			continue
+		}
+		if !scored {
+			m.help("cfst_ip_score", "gauge", "综合评分")
+			scored = true
+		}
+		m.sample("cfst_ip_score", ipLabels(&c.data[i]), *record.Score)
+	}
+
+	_, err := w.Write(m.buf.Bytes())
+	return err
+}
+
+// 是否有 IP 的该指标不为 0
+func (c *Collector) hasValue(value func(i int, cf *utils.CloudflareIPData) float64) bool {
+	for i := range c.data {
+		if value(i, &c.data[i]) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func ipLabels(cf *utils.CloudflareIPData) []string {
+	return []string{"ip", cf.IP.String(), "colo", cf.Datacenter}
+}
+
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	_ = c.Write(w)
+}
+
+// 监听指定地址提供 /metrics，ctx 取消时关闭服务
+func (c *Collector) ListenAndServe(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// 推送到 Pushgateway（替换该 job 下的所有指标）
+func (c *Collector) Push(gateway, job string) error {
+	var body bytes.Buffer
+	if err := c.Write(&body); err != nil {
+		return err
+	}
+	u := strings.TrimRight(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequest(http.MethodPut, u, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := (&http.Client{Timeout: requestTimeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("推送到 Pushgateway 失败 (HTTP %d)", resp.StatusCode)
+	}
+	return nil
+}
+
+// Prometheus 文本格式
+type writer struct {
+	buf bytes.Buffer
+}
+
+func (m *writer) help(name, typ, help string) {
+	fmt.Fprintf(&m.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labels 为 name, value 交替排列
+func (m *writer) sample(name string, labels []string, value float64) {
+	m.buf.WriteString(name)
+	if len(labels) > 0 {
+		m.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&m.buf, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		m.buf.WriteByte('}')
+	}
+	fmt.Fprintf(&m.buf, " %g\n", value)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
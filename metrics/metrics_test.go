@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+// 测速结果中的一个 IP，速度单位 MB/s
+func testIP(ip string, download, multi, upload float64) utils.CloudflareIPData {
+	return utils.CloudflareIPData{
+		PingData:      &utils.PingData{IP: &net.IPAddr{IP: net.ParseIP(ip)}, Sended: 4, Received: 4},
+		DownloadSpeed: download * 1024 * 1024,
+		MultiSpeed:    multi * 1024 * 1024,
+		UploadSpeed:   upload * 1024 * 1024,
+		Datacenter:    "NRT",
+	}
+}
+
+func writeMetrics(t *testing.T, c *Collector) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// 各项指标的名称（不含标签）
+func metricNames(out string) map[string]bool {
+	names := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names[strings.FieldsFunc(line, func(r rune) bool { return r == '{' || r == ' ' })[0]] = true
+	}
+	return names
+}
+
+func TestWriteSpeedMetrics(t *testing.T) {
+	optional := []string{
+		"cfst_ip_multi_download_speed_bytes_per_second",
+		"cfst_ip_upload_speed_bytes_per_second",
+		"cfst_ip_score",
+	}
+	tests := []struct {
+		name  string
+		data  utils.DownloadSpeedSet
+		score string
+		want  []string // 应输出的可选指标
+	}{
+		{"只有下载测速", utils.DownloadSpeedSet{testIP("1.1.1.1", 10, 0, 0), testIP("1.0.0.1", 5, 0, 0)}, "", nil},
+		{"多连接及上传测速", utils.DownloadSpeedSet{testIP("1.1.1.1", 10, 0, 0), testIP("1.0.0.1", 5, 20, 3)}, "",
+			optional[:2]},
+		{"综合评分", utils.DownloadSpeedSet{testIP("1.1.1.1", 10, 0, 0), testIP("1.0.0.1", 5, 0, 0)}, "download=1",
+			optional[2:]},
+		{"评分无效", utils.DownloadSpeedSet{testIP("1.1.1.1", 10, 0, 0)}, "download / loss", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.score != "" {
+				sc, err := utils.ParseScorer(tt.score)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sc.Sort(tt.data)
+			}
+			names := metricNames(writeMetrics(t, &Collector{data: tt.data}))
+			for _, name := range []string{"cfst_bandwidth_bytes_per_second", "cfst_best_download_speed_bytes_per_second", "cfst_ip_download_speed_bytes_per_second"} {
+				if !names[name] {
+					t.Errorf("缺少指标 %s", name)
+				}
+			}
+			for _, name := range optional {
+				want := false
+				for _, w := range tt.want {
+					want = want || w == name
+				}
+				if names[name] != want {
+					t.Errorf("是否输出 %s = %v，应为 %v", name, names[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteSpeedValues(t *testing.T) {
+	data := utils.DownloadSpeedSet{testIP("1.0.0.1", 5, 20, 3), testIP("1.1.1.1", 10, 0, 0)}
+	sc, err := utils.ParseScorer("download=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.Sort(data)
+	out := writeMetrics(t, &Collector{data: data})
+	for _, line := range []string{
+		`cfst_ip_download_speed_bytes_per_second{ip="1.1.1.1",colo="NRT"} 1.048576e+07`,
+		`cfst_ip_multi_download_speed_bytes_per_second{ip="1.0.0.1",colo="NRT"} 2.097152e+07`,
+		`cfst_ip_multi_download_speed_bytes_per_second{ip="1.1.1.1",colo="NRT"} 0`,
+		`cfst_ip_upload_speed_bytes_per_second{ip="1.0.0.1",colo="NRT"} 3.145728e+06`,
+		`cfst_ip_score{ip="1.1.1.1",colo="NRT"} 1`,
+		`cfst_ip_score{ip="1.0.0.1",colo="NRT"} 0`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("缺少 %s\n%s", line, out)
+		}
+	}
+}
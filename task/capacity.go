@@ -0,0 +1,44 @@
+package task
+
+import (
+	"context"
+	"sync"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+// 并发的总下载速度低于 单线程速度×并发数 的该比例时，认为已达到链路带宽上限
+const capacityRatio = 0.8
+
+// 测量链路带宽：先以最低延迟的 IP 单线程下载测速，再同时对前 routines 个 IP 下载测速，
+// 总速度无法随并发数增长时提示并发会拉低单个 IP 的速度（测量结果不计入下载测速结果）
+func (t *Tester) checkCapacity(ctx context.Context, ipSet utils.PingDelaySet, routines int) {
+	t.printf("测量链路带宽（单线程及 %d 并发，约 %v）...\n", routines, 2*t.opts.Timeout)
+	single, _ := t.downloadHandler(ctx, ipSet[0].IP, nil, 0)
+	speeds := make([]float64, routines)
+	var wg sync.WaitGroup
+	for i := 0; i < routines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			speeds[i], _ = t.downloadHandler(ctx, ipSet[i].IP, nil, i)
+		}(i)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+	var total float64
+	for _, s := range speeds {
+		total += s
+	}
+	t.printf("单线程下载速度：%.2f MB/s，%d 并发总下载速度：%.2f MB/s\n", single/1024/1024, routines, total/1024/1024)
+	if single <= 0 || total >= single*float64(routines)*capacityRatio {
+		return
+	}
+	suggest := int(total / single)
+	if suggest < 1 {
+		suggest = 1
+	}
+	t.printf("[提示] 并发 %d 时总下载速度已接近链路带宽上限，各 IP 测得的下载速度会明显偏低，建议下载测速并发数不超过 %d。\n", routines, suggest)
+}
@@ -0,0 +1,74 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/colo"
+)
+
+// 数据中心筛选条件：满足任一匹配条件（地区、国家、大洲）且不在排除列表中，匹配条件均为空时不限
+type coloFilter struct {
+	colos      map[string]bool
+	countries  map[string]bool
+	continents map[string]bool
+	exclude    map[string]bool
+}
+
+// 均未指定时返回 nil
+func newColoFilter(o Options) *coloFilter {
+	if o.HttpingCFColo == "" && o.ColoCountries == "" && o.ColoContinents == "" && o.ColoExclude == "" {
+		return nil
+	}
+	return &coloFilter{
+		colos:      splitUpper(o.HttpingCFColo),
+		countries:  splitUpper(o.ColoCountries),
+		continents: splitUpper(o.ColoContinents),
+		exclude:    splitUpper(o.ColoExclude),
+	}
+}
+
+// 将参数指定的英文逗号分隔的列表转为大写并格式化
+func splitUpper(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, v := range strings.Split(strings.ToUpper(s), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			m[v] = true
+		}
+	}
+	return m
+}
+
+func (f *coloFilter) match(iata string) bool {
+	if f.exclude[iata] {
+		return false
+	}
+	if len(f.colos) == 0 && len(f.countries) == 0 && len(f.continents) == 0 {
+		return true
+	}
+	if f.colos[iata] {
+		return true
+	}
+	l, ok := colo.Lookup(iata) // 位置未知的数据中心只能通过三字码匹配
+	return ok && (f.countries[l.Country] || f.continents[l.Continent])
+}
+
+func checkColoFilter(o Options) error {
+	for c := range splitUpper(o.ColoContinents) {
+		if !colo.IsContinent(c) {
+			return fmt.Errorf("无效的大洲代码 [%s]，可选 %s", c, strings.Join(colo.Continents, "、"))
+		}
+	}
+	return nil
+}
+
+// 匹配 机场三字码 是否为指定的地区，未指定地区时均视为匹配
+func (t *Tester) matchColo(colo string) bool {
+	if colo == "" {
+		return false
+	}
+	if t.colos == nil {
+		return true
+	}
+	return t.colos.match(colo)
+}
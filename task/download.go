@@ -16,22 +16,16 @@ import (
 )
 
 const (
-	bufferSize                     = 1024
-	defaultURL                     = "https://cf.xiu2.xyz/url"
-	defaultTimeout                 = 10 * time.Second
-	defaultDisableDownload         = false
-	defaultTestNum                 = 10
-	defaultMinSpeed        float64 = 0.0
+	bufferSize                      = 1024
+	defaultURL                      = "https://cf.xiu2.xyz/url"
+	defaultTimeout                  = 10 * time.Second
+	defaultDisableDownload          = false
+	defaultTestNum                  = 10
+	defaultMinSpeed         float64 = 0.0
+	defaultDownloadRoutines         = 1
 )
 
 var (
-	URL     = defaultURL
-	Timeout = defaultTimeout
-	Disable = defaultDisableDownload
-
-	TestCount = defaultTestNum
-	MinSpeed  = defaultMinSpeed
-
 	// 使用 sync.Pool 管理缓冲区
 	bufferPool = sync.Pool{
 		New: func() interface{} {
@@ -40,59 +34,103 @@ var (
 	}
 )
 
-func checkDownloadDefault() {
-	if URL == "" {
-		URL = defaultURL
-	}
-	if Timeout <= 0 {
-		Timeout = defaultTimeout
-	}
-	if TestCount <= 0 {
-		TestCount = defaultTestNum
-	}
-	if MinSpeed <= 0.0 {
-		MinSpeed = defaultMinSpeed
-	}
-}
-
-func TestDownloadSpeed(ipSet utils.PingDelaySet) (speedSet utils.DownloadSpeedSet) {
-	checkDownloadDefault()
-	if Disable {
-		return utils.DownloadSpeedSet(ipSet)
+// 下载测速，ctx 取消时返回已有的结果及 ctx.Err()
+func (t *Tester) TestDownloadSpeed(ctx context.Context, ipSet utils.PingDelaySet) (speedSet utils.DownloadSpeedSet, err error) {
+	if t.opts.Disable {
+		return utils.DownloadSpeedSet(ipSet), nil
 	}
 	if len(ipSet) <= 0 { // IP数组长度(IP数量) 大于 0 时才会继续下载测速
-		fmt.Println("\n[信息] 延迟测速结果 IP 数量为 0，跳过下载测速。")
+		t.printf("\n[信息] 延迟测速结果 IP 数量为 0，跳过下载测速。\n")
 		return
 	}
-	testNum := TestCount
-	if len(ipSet) < TestCount || MinSpeed > 0 { // 如果IP数组长度(IP数量) 小于下载测速数量（-dn），则次数修正为IP数
+	testCount := t.opts.TestCount
+	testNum := testCount
+	if len(ipSet) < testCount || t.opts.MinSpeed > 0 { // 如果IP数组长度(IP数量) 小于下载测速数量（-dn），则次数修正为IP数
 		testNum = len(ipSet)
 	}
-	if testNum < TestCount {
-		TestCount = testNum
+	if testNum < testCount {
+		testCount = testNum
+	}
+	routines := t.opts.DownloadRoutines
+	if routines > testNum {
+		routines = testNum
 	}
 
-	fmt.Printf("开始下载测速（下限：%.2f MB/s, 数量：%d, 队列：%d）\n", MinSpeed, TestCount, testNum)
+	if routines > 1 {
+		t.printf("开始下载测速（下限：%.2f MB/s, 数量：%d, 队列：%d, 并发：%d）\n", t.opts.MinSpeed, testCount, testNum, routines)
+		if t.opts.TestCapacity {
+			t.checkCapacity(ctx, ipSet, routines)
+		} else {
+			t.printf("[提示] 并发下载测速时各 IP 共享本机带宽，测得的速度可能偏低，可使用 [-dcap] 先测量链路带宽。\n")
+		}
+	} else {
+		t.printf("开始下载测速（下限：%.2f MB/s, 数量：%d, 队列：%d）\n", t.opts.MinSpeed, testCount, testNum)
+	}
+	conns := t.opts.Connections
+	if conns > 1 {
+		t.printf("每个 IP 单连接下载测速后，再以 %d 个连接同时下载测速，单个 IP 的测速耗时约翻倍。\n", conns)
+	}
 	// 控制 下载测速进度条 与 延迟测速进度条 长度一致（强迫症）
 	bar_a := len(strconv.Itoa(len(ipSet)))
 	bar_b := "     "
 	for i := 0; i < bar_a; i++ {
 		bar_b += " "
 	}
-	bar := utils.NewBar(TestCount, bar_b, "")
+	bar := t.newBar(testCount, bar_b, "")
+	t.setStage(StageDownload, testCount)
+
+	// 凑够满足条件的 IP 时取消其余正在进行的下载测速
+	downloadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		slots = make(chan int, routines) // 空闲的并发序号
+	)
+	for i := 0; i < routines; i++ {
+		slots <- i
+	}
 	for i := 0; i < testNum; i++ {
-		speed := downloadHandler(ipSet[i].IP)
-		ipSet[i].DownloadSpeed = speed
-		// 在每个 IP 下载测速后，以 [下载速度下限] 条件过滤结果
-		if speed >= MinSpeed*1024*1024 {
-			bar.Grow(1, "")
-			speedSet = append(speedSet, ipSet[i]) // 高于下载速度下限时，添加到新数组中
-			if len(speedSet) == TestCount {       // 凑够满足条件的 IP 时（下载测速数量 -dn），就跳出循环
-				break
-			}
+		slot := <-slots
+		if downloadCtx.Err() != nil { // 已取消或已凑够时不再继续测速
+			break
 		}
+		wg.Add(1)
+		go func(i, slot int) {
+			defer wg.Done()
+			defer func() { slots <- slot }()
+			speed, colo := t.downloadHandler(downloadCtx, ipSet[i].IP, bar, slot*conns)
+			var multiSpeed float64
+			if conns > 1 && speed > 0 { // 单连接无法下载时不再测多连接
+				multiSpeed = t.multiDownload(downloadCtx, ipSet[i].IP, bar, slot*conns, conns)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(speedSet) == testCount { // 已凑够时丢弃被中断的测速结果
+				return
+			}
+			ipSet[i].DownloadSpeed = speed
+			ipSet[i].MultiSpeed = multiSpeed
+			if ipSet[i].Datacenter == "" { // 延迟测速阶段未获取到数据中心时，以下载测速的响应头为准
+				ipSet[i].Datacenter = colo
+			}
+			// 在每个 IP 下载测速后，以 [下载速度下限] 条件过滤结果
+			if speed >= t.opts.MinSpeed*1024*1024 {
+				bar.Grow(1, "")
+				t.growProgress(1, 0)
+				speedSet = append(speedSet, ipSet[i]) // 高于下载速度下限时，添加到新数组中
+				if len(speedSet) == testCount {       // 凑够满足条件的 IP 时（下载测速数量 -dn），就停止测速
+					cancel()
+				}
+			}
+		}(i, slot)
 	}
+	wg.Wait()
+	err = ctx.Err()
 	bar.Done()
+	if conns > 1 {
+		t.warnThrottle(speedSet)
+	}
 	if len(speedSet) == 0 { // 没有符合速度限制的数据，返回所有测试数据
 		speedSet = utils.DownloadSpeedSet(ipSet)
 	}
@@ -101,27 +139,30 @@ func TestDownloadSpeed(ipSet utils.PingDelaySet) (speedSet utils.DownloadSpeedSe
 	return
 }
 
-func getDialContext(ip *net.IPAddr) func(ctx context.Context, network, address string) (net.Conn, error) {
+func (t *Tester) dialContext(ip *net.IPAddr) func(ctx context.Context, network, address string) (net.Conn, error) {
 	var fakeSourceAddr string
 	if isIPv4(ip.String()) {
-		fakeSourceAddr = fmt.Sprintf("%s:%d", ip.String(), TCPPort)
+		fakeSourceAddr = fmt.Sprintf("%s:%d", ip.String(), t.opts.TCPPort)
 	} else {
-		fakeSourceAddr = fmt.Sprintf("[%s]:%d", ip.String(), TCPPort)
+		fakeSourceAddr = fmt.Sprintf("[%s]:%d", ip.String(), t.opts.TCPPort)
 	}
 	return func(ctx context.Context, network, address string) (net.Conn, error) {
 		return (&net.Dialer{}).DialContext(ctx, network, fakeSourceAddr)
 	}
 }
 
-// return download Speed
-func downloadHandler(ip *net.IPAddr) float64 {
+// return download Speed and colo
+func (t *Tester) downloadHandler(ctx context.Context, ip *net.IPAddr, bar *utils.Bar, slot int) (float64, string) {
+	timeout := t.opts.Timeout
 	// 从池中获取缓冲区
 	buffer := bufferPool.Get().([]byte)
 	defer bufferPool.Put(buffer)
 
+	transport, closeTransport := t.downloadTransport(ip)
+	defer closeTransport()
 	client := &http.Client{
-		Transport: &http.Transport{DialContext: getDialContext(ip)},
-		Timeout:   Timeout,
+		Transport: transport,
+		Timeout:   timeout,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if len(via) > 10 { // 限制最多重定向 10 次
 				return http.ErrUseLastResponse
@@ -132,30 +173,31 @@ func downloadHandler(ip *net.IPAddr) float64 {
 			return nil
 		},
 	}
-	req, err := http.NewRequest("GET", URL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", t.opts.URL, nil)
 	if err != nil {
-		return 0.0
+		return 0.0, ""
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
+	t.setRequestHeader(req)
 
 	response, err := client.Do(req)
 	if err != nil {
-		return 0.0
+		return 0.0, ""
 	}
 	defer response.Body.Close()
+	colo := getHeaderColo(response.Header)
 	if response.StatusCode != 200 {
-		return 0.0
+		return 0.0, colo
 	}
 
 	timeStart := time.Now()           // 开始时间（当前）
-	timeEnd := timeStart.Add(Timeout) // 加上下载测速时间得到的结束时间
+	timeEnd := timeStart.Add(timeout) // 加上下载测速时间得到的结束时间
 
 	contentLength := response.ContentLength // 文件大小
 
 	var (
 		contentRead     int64 = 0
-		timeSlice             = Timeout / 100
+		timeSlice             = timeout / 100
 		timeCounter           = 1
 		lastContentRead int64 = 0
 	)
@@ -172,7 +214,7 @@ func downloadHandler(ip *net.IPAddr) float64 {
 			// 计算当前速度并更新总带宽
 			currentSpeed := float64(contentRead - lastContentRead)
 			e.Add(currentSpeed)
-			utils.UpdateBandwidth(int64(e.Value() / (Timeout.Seconds() / 120)))
+			t.setBandwidth(bar, slot, int64(e.Value()/(timeout.Seconds()/120)))
 			lastContentRead = contentRead
 		}
 		// 如果超出下载测速时间，则退出循环（终止测速）
@@ -195,7 +237,7 @@ func downloadHandler(ip *net.IPAddr) float64 {
 	}
 
 	// 测试结束后清零带宽
-	defer utils.UpdateBandwidth(0)
-	return e.Value() / (Timeout.Seconds() / 120)
+	defer t.setBandwidth(bar, slot, 0)
+	return e.Value() / (timeout.Seconds() / 120), colo
 }
 
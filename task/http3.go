@@ -0,0 +1,84 @@
+package task
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const quicHandshakeTimeout = time.Second * 2
+
+var errNoHTTP3 = errors.New("当前程序未包含 HTTP/3 支持，无法使用 [-http3]，请按 README 中 HTTP/3 (QUIC) 一节的方法在 h3 目录中编译包含 HTTP/3 支持的版本")
+
+// HTTP/3 (QUIC) 的实现。QUIC 库需要较新的 Go 版本，为不影响以 Go 1.16 构建的版本，
+// 实现放在单独的 h3 模块中，由其在 init 中通过 RegisterHTTP3 注册
+type HTTP3 interface {
+	// 与 address (IP:端口) 完成 QUIC 握手（含 TLS 1.3）后关闭连接，返回握手耗时
+	Handshake(ctx context.Context, address string, config *tls.Config) (time.Duration, error)
+	// 所有请求均发往 address (IP:端口) 的 HTTP/3 Transport，使用完毕后需关闭
+	Transport(address string, config *tls.Config) RoundTripCloser
+}
+
+type RoundTripCloser interface {
+	http.RoundTripper
+	io.Closer
+}
+
+var http3 HTTP3 // 为 nil 时不支持 HTTP3 模式
+
+// 注册 HTTP/3 的实现
+func RegisterHTTP3(h HTTP3) {
+	http3 = h
+}
+
+func checkHTTP3(o Options) error {
+	if o.HTTP3 && http3 == nil {
+		return errNoHTTP3
+	}
+	return nil
+}
+
+func (t *Tester) address(ip *net.IPAddr) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(t.opts.TCPPort))
+}
+
+// QUIC 握手延迟，即 UDP 上的连接及 TLS 握手的总耗时
+func (p *Ping) quicping(ip *net.IPAddr) (bool, time.Duration) {
+	if http3 == nil { // NewTester 已检查，不应出现
+		return false, 0
+	}
+	ctx, cancel := context.WithTimeout(p.ctx, quicHandshakeTimeout)
+	defer cancel()
+	config := p.tlsConfig()
+	config.ServerName = p.serverName()
+	duration, err := http3.Handshake(ctx, p.address(ip), config)
+	if err != nil {
+		return false, 0
+	}
+	return true, duration
+}
+
+// 下载测速使用的 Transport，HTTP3 模式下为 HTTP/3（未注册实现时所有请求均失败），返回的函数用于关闭连接
+func (t *Tester) downloadTransport(ip *net.IPAddr) (http.RoundTripper, func()) {
+	if t.opts.HTTP3 {
+		if http3 == nil {
+			return noHTTP3{}, func() {}
+		}
+		transport := http3.Transport(t.address(ip), t.tlsConfig())
+		return transport, func() { _ = transport.Close() }
+	}
+	transport := &http.Transport{DialContext: t.dialContext(ip), TLSClientConfig: t.tlsConfig()}
+	return transport, transport.CloseIdleConnections
+}
+
+// 未注册 HTTP/3 实现时使用的 Transport
+type noHTTP3 struct{}
+
+func (noHTTP3) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errNoHTTP3
+}
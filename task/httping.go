@@ -1,141 +1,126 @@
 package task
 
 import (
-	//"crypto/tls"
+	"crypto/tls"
 	//"fmt"
-	"io"
-	"log"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"regexp"
-	"strings"
-	"sync"
 	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
 )
 
 var (
-	Httping           bool
-	HttpingStatusCode int
-	HttpingCFColo     string
-	HttpingCFColomap  *sync.Map
-	OutRegexp         = regexp.MustCompile(`[A-Z]{3}`)
+	OutRegexp = regexp.MustCompile(`[A-Z]{3}`)
 )
 
-// pingReceived pingTotalTime
-func (p *Ping) httping(ip *net.IPAddr) (int, time.Duration) {
+// 返回每次成功测速的延迟、各阶段耗时及数据中心（机场三字码）
+func (p *Ping) httping(ip *net.IPAddr) ([]time.Duration, []utils.DelayPhases, string) {
 	hc := http.Client{
 		Timeout: time.Second * 2,
 		Transport: &http.Transport{
-			DialContext: getDialContext(ip),
-			//TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // 跳过证书验证
+			DialContext:       p.dialContext(ip),
+			DisableKeepAlives: true, // 每次测速均重新建立连接，使各次的延迟及各阶段耗时可比
+			TLSClientConfig:   p.tlsConfig(),
 		},
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse // 阻止重定向
 		},
 	}
 
-	// 先访问一次获得 HTTP 状态码 及 Cloudflare Colo
+	// 先访问一次检查响应是否有效，并获得 Cloudflare Colo
+	var colo string
 	{
-		requ, err := http.NewRequest(http.MethodHead, URL, nil)
+		requ, err := http.NewRequestWithContext(p.ctx, p.rule.method(), p.opts.URL, nil)
 		if err != nil {
-			return 0, 0
+			return nil, nil, ""
 		}
-		requ.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
+		p.setRequestHeader(requ)
 		resp, err := hc.Do(requ)
 		if err != nil {
-			return 0, 0
+			return nil, nil, ""
 		}
 		defer resp.Body.Close()
 
 		//fmt.Println("IP:", ip, "StatusCode:", resp.StatusCode, resp.Request.URL)
-		// 如果未指定的 HTTP 状态码，或指定的状态码不合规，则默认只认为 200、301、302 才算 HTTPing 通过
-		if HttpingStatusCode == 0 || HttpingStatusCode < 100 && HttpingStatusCode > 599 {
-			if resp.StatusCode != 200 && resp.StatusCode != 301 && resp.StatusCode != 302 {
-				return 0, 0
-			}
-		} else {
-			if resp.StatusCode != HttpingStatusCode {
-				return 0, 0
-			}
+		// 状态码、响应头、响应内容不符合规则（如被劫持到拦截页面）则直接结束该 IP 测试
+		if !p.rule.match(resp) {
+			return nil, nil, ""
 		}
 
-		io.Copy(io.Discard, resp.Body)
-
+		colo = getHeaderColo(resp.Header)
 		// 只有指定了地区才匹配机场三字码
-		if HttpingCFColo != "" {
-			// 通过头部 Server 值判断是 Cloudflare 还是 AWS CloudFront 并设置 cfRay 为各自的机场三字码完整内容
-			cfRay := func() string {
-				if resp.Header.Get("Server") == "cloudflare" {
-					return resp.Header.Get("CF-RAY") // 示例 cf-ray: 7bd32409eda7b020-SJC
-				}
-				return resp.Header.Get("x-amz-cf-pop") // 示例 X-Amz-Cf-Pop: SIN52-P1
-			}()
-			colo := p.getColo(cfRay)
-			if colo == "" { // 没有匹配到三字码或不符合指定地区则直接结束该 IP 测试
-				return 0, 0
-			}
+		if p.colos != nil && !p.matchColo(colo) { // 没有匹配到三字码或不符合指定地区则直接结束该 IP 测试
+			return nil, nil, ""
 		}
 
 	}
 
-	// 循环测速计算延迟
-	success := 0
-	var delay time.Duration
-	for i := 0; i < PingTimes; i++ {
-		requ, err := http.NewRequest(http.MethodHead, URL, nil)
-		if err != nil {
-			log.Fatal("意外的错误，情报告：", err)
-			return 0, 0
-		}
-		requ.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36")
-		if i == PingTimes-1 {
-			requ.Header.Set("Connection", "close")
+	// 循环测速计算延迟，响应不符合规则的不计入已接收
+	var delays []time.Duration
+	var phases []utils.DelayPhases
+	for i := 0; i < p.opts.PingTimes; i++ {
+		var phase utils.DelayPhases
+		requ, err := http.NewRequestWithContext(httptrace.WithClientTrace(p.ctx, traceDelayPhases(&phase)), p.rule.method(), p.opts.URL, nil)
+		if err != nil { // 作为库使用时不能退出进程，视为该 IP 测速失败
+			return nil, nil, ""
 		}
+		p.setRequestHeader(requ)
 		startTime := time.Now()
 		resp, err := hc.Do(requ)
 		if err != nil {
 			continue
 		}
-		success++
-		io.Copy(io.Discard, resp.Body)
+		ok := p.rule.match(resp) // 不复用连接，无需读完响应内容
 		_ = resp.Body.Close()
 		duration := time.Since(startTime)
-		delay += duration
+		if !ok {
+			continue
+		}
+		delays = append(delays, duration)
+		phases = append(phases, phase)
 
 	}
 
-	return success, delay
+	return delays, phases, colo
 
 }
 
-func MapColoMap() *sync.Map {
-	if HttpingCFColo == "" {
-		return nil
-	}
-	// 将参数指定的地区三字码转为大写并格式化
-	colos := strings.Split(strings.ToUpper(HttpingCFColo), ",")
-	colomap := &sync.Map{}
-	for _, colo := range colos {
-		colomap.Store(colo, colo)
+// 通过 httptrace 记录单次请求的连接、TLS 握手及首字节耗时
+func traceDelayPhases(phase *utils.DelayPhases) *httptrace.ClientTrace {
+	var connectStart, tlsStart, wroteRequest time.Time
+	return &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) { connectStart = time.Now() },
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				phase.Connect = time.Since(connectStart)
+			}
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil {
+				phase.TLS = time.Since(tlsStart)
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { phase.TTFB = time.Since(wroteRequest) },
 	}
-	return colomap
 }
 
-func (p *Ping) getColo(b string) string {
-	if b == "" {
+// 从响应头中获取机场三字码
+func getHeaderColo(header http.Header) string {
+	// 通过头部 Server 值判断是 Cloudflare 还是 AWS CloudFront 并设置 cfRay 为各自的机场三字码完整内容
+	var cfRay string
+	if header.Get("Server") == "cloudflare" {
+		cfRay = header.Get("CF-RAY") // 示例 cf-ray: 7bd32409eda7b020-SJC
+	} else {
+		cfRay = header.Get("x-amz-cf-pop") // 示例 X-Amz-Cf-Pop: SIN52-P1
+	}
+	if cfRay == "" {
 		return ""
 	}
 	// 正则匹配并返回 机场三字码
-	out := OutRegexp.FindString(b)
-
-	if HttpingCFColomap == nil {
-		return out
-	}
-	// 匹配 机场三字码 是否为指定的地区
-	_, ok := HttpingCFColomap.Load(out)
-	if ok {
-		return out
-	}
-
-	return ""
+	return OutRegexp.FindString(cfRay)
 }
@@ -0,0 +1,183 @@
+package task
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	icmpTimeout     = time.Second * 1
+	icmpPayloadSize = 32
+)
+
+// ICMP 套接字，优先使用无需特权的数据报套接字（Linux 需 net.ipv4.ping_group_range 包含当前用户组），不可用时使用原始套接字
+type icmpConn struct {
+	*icmp.PacketConn
+	datagram bool // 数据报套接字由内核改写并过滤 Echo ID
+	ipv4     bool
+	id       int // 原始套接字使用的 Echo ID，取自 icmpNextID，同一进程中（包括不同的池）同时使用的各套接字互不相同
+	seq      int // 上一次 Echo 的序号，每次加一，避免匹配到之前超时的应答
+}
+
+func listenICMP(ipv4 bool) (*icmpConn, error) {
+	network, raw, address := "udp6", "ip6:ipv6-icmp", "::"
+	if ipv4 {
+		network, raw, address = "udp4", "ip4:icmp", "0.0.0.0"
+	}
+	if conn, err := icmp.ListenPacket(network, address); err == nil {
+		return &icmpConn{PacketConn: conn, datagram: true, ipv4: ipv4}, nil
+	}
+	conn, err := icmp.ListenPacket(raw, address)
+	if err != nil {
+		return nil, err
+	}
+	return &icmpConn{PacketConn: conn, ipv4: ipv4}, nil
+}
+
+// 原始套接字的 Echo ID 计数器，所有池共用（API 可同时进行多次测速），以进程 ID 为初始值以免与其他 ping 程序冲突
+var icmpNextID = uint32(os.Getpid())
+
+// ICMP 套接字池，各延迟测速线程按地址族复用套接字，而不是每次 Echo 都新建一个
+// （原始套接字会收到本机所有的 ICMP 应答，套接字越多开销越大）
+type icmpPool struct {
+	idle [2]chan *icmpConn // 空闲的 IPv4、IPv6 套接字
+}
+
+func newICMPPool(size int) *icmpPool {
+	return &icmpPool{
+		idle: [2]chan *icmpConn{make(chan *icmpConn, size), make(chan *icmpConn, size)},
+	}
+}
+
+func (p *icmpPool) family(ipv4 bool) chan *icmpConn {
+	if ipv4 {
+		return p.idle[0]
+	}
+	return p.idle[1]
+}
+
+// 取出一个空闲的套接字，没有时新建
+func (p *icmpPool) get(ipv4 bool) (*icmpConn, error) {
+	select {
+	case conn := <-p.family(ipv4):
+		return conn, nil
+	default:
+	}
+	conn, err := listenICMP(ipv4)
+	if err != nil {
+		return nil, err
+	}
+	conn.id = int(atomic.AddUint32(&icmpNextID, 1) & 0xffff)
+	return conn, nil
+}
+
+// 归还套接字，池已满时直接关闭
+func (p *icmpPool) put(conn *icmpConn) {
+	select {
+	case p.family(conn.ipv4) <- conn:
+	default:
+		_ = conn.Close()
+	}
+}
+
+// 关闭所有空闲的套接字，需在所有测速结束后调用
+func (p *icmpPool) close() {
+	for _, idle := range p.idle {
+		for len(idle) > 0 {
+			_ = (<-idle).Close()
+		}
+	}
+}
+
+// 检查是否可以创建 ICMP 套接字，IPv4 与 IPv6 均不可用时返回错误
+func checkICMP() error {
+	conn, err := listenICMP(true)
+	if err != nil {
+		if conn, err = listenICMP(false); err != nil {
+			return fmt.Errorf("无法创建 ICMP 套接字，请以管理员/root 权限运行，或将当前用户组加入 net.ipv4.ping_group_range：%v", err)
+		}
+	}
+	return conn.Close()
+}
+
+func (c *icmpConn) addr(ip *net.IPAddr) net.Addr {
+	if c.datagram {
+		return &net.UDPAddr{IP: ip.IP, Zone: ip.Zone}
+	}
+	return ip
+}
+
+// 发送一个 ICMP Echo 请求并等待对应的应答
+func (c *icmpConn) echo(ip *net.IPAddr, deadline time.Time) (bool, time.Duration) {
+	c.seq = (c.seq + 1) & 0xffff
+	id, seq := c.id, c.seq
+	msg := icmp.Message{Body: &icmp.Echo{ID: id, Seq: seq, Data: make([]byte, icmpPayloadSize)}}
+	var replyType icmp.Type = ipv4.ICMPTypeEchoReply
+	if c.ipv4 {
+		msg.Type = ipv4.ICMPTypeEcho
+	} else {
+		msg.Type, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+	b, err := msg.Marshal(nil) // IPv6 校验和由内核计算
+	if err != nil {
+		return false, 0
+	}
+	if err = c.SetDeadline(deadline); err != nil {
+		return false, 0
+	}
+	startTime := time.Now()
+	if _, err = c.WriteTo(b, c.addr(ip)); err != nil {
+		return false, 0
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := c.ReadFrom(buf)
+		if err != nil { // 超时
+			return false, 0
+		}
+		duration := time.Since(startTime)
+		if !peerIP(peer).Equal(ip.IP) {
+			continue
+		}
+		reply, err := icmp.ParseMessage(replyType.Protocol(), buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		// 原始套接字会收到本机所有的 ICMP 报文，需以 ID 及序号区分
+		if body, ok := reply.Body.(*icmp.Echo); !ok || body.Seq != seq || !c.datagram && body.ID != id {
+			continue
+		}
+		return true, duration
+	}
+}
+
+func peerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// bool connectionSucceed float32 time
+func (p *Ping) icmping(ip *net.IPAddr) (bool, time.Duration) {
+	conn, err := p.icmp.get(isIPv4(ip.String()))
+	if err != nil {
+		return false, 0
+	}
+	defer p.icmp.put(conn)
+	deadline := time.Now().Add(icmpTimeout)
+	if d, ok := p.ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return conn.echo(ip, deadline)
+}
@@ -0,0 +1,140 @@
+package task
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 本机不允许创建 ICMP 套接字（非 root 且 ping_group_range 不包含当前用户组）或没有该地址族的环回地址时跳过
+func loopbackICMP(t *testing.T, pool *icmpPool, ip string) (*icmpConn, *net.IPAddr) {
+	t.Helper()
+	addr := &net.IPAddr{IP: net.ParseIP(ip)}
+	network := "udp6"
+	if isIPv4(ip) {
+		network = "udp4"
+	}
+	if c, err := net.ListenUDP(network, &net.UDPAddr{IP: addr.IP}); err != nil {
+		t.Skipf("没有环回地址 [%s]：%v", ip, err)
+	} else {
+		_ = c.Close()
+	}
+	conn, err := pool.get(isIPv4(ip))
+	if err != nil {
+		t.Skipf("无法创建 ICMP 套接字：%v", err)
+	}
+	return conn, addr
+}
+
+func TestICMPEchoLoopback(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "::1"} {
+		t.Run(ip, func(t *testing.T) {
+			pool := newICMPPool(1)
+			defer pool.close()
+			conn, addr := loopbackICMP(t, pool, ip)
+			defer pool.put(conn)
+			for i := 1; i <= 3; i++ {
+				ok, delay := conn.echo(addr, time.Now().Add(icmpTimeout))
+				if !ok {
+					t.Fatalf("第 %d 次 Echo 没有收到应答", i)
+				}
+				if delay <= 0 || delay >= icmpTimeout {
+					t.Errorf("第 %d 次 Echo 的延迟 = %v", i, delay)
+				}
+				if conn.seq != i {
+					t.Errorf("第 %d 次 Echo 的序号 = %d", i, conn.seq)
+				}
+			}
+		})
+	}
+}
+
+// 原始套接字会收到所有套接字的应答，多个套接字同时 Echo 时各自只能匹配到自己的应答
+func TestICMPConcurrentEchoLoopback(t *testing.T) {
+	concurrentEcho(t, []*icmpPool{newICMPPool(16)}, 16)
+}
+
+// API 可同时进行多次测速，各自的池中的套接字也不能使用相同的 Echo ID
+func TestICMPPoolsConcurrentEchoLoopback(t *testing.T) {
+	concurrentEcho(t, []*icmpPool{newICMPPool(8), newICMPPool(8)}, 8)
+}
+
+// 从每个池中各取出 workers 个套接字同时 Echo，原始套接字的 Echo ID 应互不相同，且不丢失应答
+func concurrentEcho(t *testing.T, pools []*icmpPool, workers int) {
+	t.Helper()
+	const times = 5
+	for _, pool := range pools {
+		defer pool.close()
+	}
+	conns := make(map[*icmpConn]*icmpPool)
+	ids := make(map[int]bool)
+	var addr *net.IPAddr
+	for _, pool := range pools {
+		for i := 0; i < workers; i++ {
+			var conn *icmpConn
+			conn, addr = loopbackICMP(t, pool, "127.0.0.1")
+			conns[conn] = pool
+			if !conn.datagram {
+				if ids[conn.id] {
+					t.Fatalf("Echo ID [%d] 重复", conn.id)
+				}
+				ids[conn.id] = true
+			}
+		}
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	lost := 0
+	for conn, pool := range conns {
+		wg.Add(1)
+		go func(conn *icmpConn, pool *icmpPool) {
+			defer wg.Done()
+			defer pool.put(conn)
+			for i := 0; i < times; i++ {
+				if ok, _ := conn.echo(addr, time.Now().Add(icmpTimeout)); !ok {
+					mu.Lock()
+					lost++
+					mu.Unlock()
+				}
+			}
+		}(conn, pool)
+	}
+	wg.Wait()
+	if lost > 0 {
+		t.Fatalf("%d 个套接字同时 Echo，共 %d 次没有匹配到应答", len(conns), lost)
+	}
+	for i, pool := range pools {
+		if n := len(pool.idle[0]); n != workers {
+			t.Errorf("第 %d 个池归还后空闲的套接字数量 = %d，应为 %d", i+1, n, workers)
+		}
+	}
+}
+
+func TestTesterICMPLoopback(t *testing.T) {
+	pool := newICMPPool(2)
+	conn, _ := loopbackICMP(t, pool, "127.0.0.1")
+	pool.put(conn)
+	pool.close()
+
+	opts := DefaultOptions()
+	opts.ICMP = true
+	opts.Quiet = true
+	opts.PingTimes = 3
+	opts.IPText = "127.0.0.1"
+	tester, err := NewTester(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tester.Ping(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1 {
+		t.Fatalf("延迟测速结果数量 = %d，应为 1", len(data))
+	}
+	if d := data[0]; d.Sended != 3 || d.Received != 3 || d.Delay <= 0 || d.MaxDelay < d.MinDelay {
+		t.Errorf("延迟测速结果有误：发送 %d 接收 %d 平均 %v 最小 %v 最大 %v", d.Sended, d.Received, d.Delay, d.MinDelay, d.MaxDelay)
+	}
+}
@@ -2,7 +2,7 @@ package task
 
 import (
 	"bufio"
-	"log"
+	"fmt"
 	"math/rand"
 	"net"
 	"os"
@@ -20,18 +20,6 @@ const (
 	maxTestQueue    = 200000  // 最大延迟测速队列
 )
 
-var (
-	// TestAll4 test all ip
-	TestAll4 = false
-	// IPv4TestNum 指定 IPv4 测试数量
-	IPv4TestNum = 0
-	// IPv6TestNum 指定 IPv6 测试数量
-	IPv6TestNum = 0
-	// IPFile is the filename of IP Rangs
-	IPFile = defaultInputFile
-	IPText string
-)
-
 func InitRandSeed() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -52,11 +40,18 @@ type IPRanges struct {
 	mask    string
 	firstIP net.IP
 	ipNet   *net.IPNet
+
+	testAll4    bool // 测速全部的 IPv4
+	ipv4TestNum int  // 指定 IPv4 测试数量
+	ipv6TestNum int  // 指定 IPv6 测试数量
 }
 
-func newIPRanges() *IPRanges {
+func newIPRanges(opts Options) *IPRanges {
 	return &IPRanges{
-		ips: make([]*net.IPAddr, 0),
+		ips:         make([]*net.IPAddr, 0),
+		testAll4:    opts.TestAll4,
+		ipv4TestNum: opts.IPv4TestNum,
+		ipv6TestNum: opts.IPv6TestNum,
 	}
 }
 
@@ -77,11 +72,12 @@ func (r *IPRanges) fixIP(ip string) string {
 }
 
 // 解析 IP 段，获得 IP、IP 范围、子网掩码
-func (r *IPRanges) parseCIDR(ip string) {
+func (r *IPRanges) parseCIDR(ip string) error {
 	var err error
 	if r.firstIP, r.ipNet, err = net.ParseCIDR(r.fixIP(ip)); err != nil {
-		log.Fatalln("ParseCIDR err", err)
+		return fmt.Errorf("ParseCIDR err %v", err)
 	}
+	return nil
 }
 
 func (r *IPRanges) appendIPv4(d byte) {
@@ -190,14 +186,14 @@ func (r *IPRanges) chooseIPv4() {
 	
 	minIP, hosts := r.getIPRange()
 	cidrSize := int(hosts) + 1
-	testNum := IPv4TestNum
+	testNum := r.ipv4TestNum
 	
 	if testNum > cidrSize {
 		testNum = cidrSize
 	}
 	
 	for r.ipNet.Contains(r.firstIP) {
-		if TestAll4 || testNum >= cidrSize {
+		if r.testAll4 || testNum >= cidrSize {
 			// 测试所有 IP
 			for i := 0; i <= int(hosts); i++ {
 				r.appendIPv4(byte(i) + minIP)
@@ -233,7 +229,7 @@ func (r *IPRanges) chooseIPv6() {
 	}
 	
 	cidrSize := calculateCIDRSize(r.ipNet)
-	testNum := IPv6TestNum
+	testNum := r.ipv6TestNum
 	
 	if testNum <= 0 {
 		// 默认只测一个
@@ -279,29 +275,32 @@ func (r *IPRanges) appendRandomIPv6() {
 	}
 }
 
-func loadIPRanges() []*net.IPAddr {
-	ranges := newIPRanges()
-	if IPText != "" { // 从参数中获取 IP 段数据
-			IPs := strings.Split(IPText, ",") // 以逗号分隔为数组并循环遍历
+func loadIPRanges(opts Options) ([]*net.IPAddr, error) {
+	ranges := newIPRanges(opts)
+	if opts.IPText != "" { // 从参数中获取 IP 段数据
+			IPs := strings.Split(opts.IPText, ",") // 以逗号分隔为数组并循环遍历
 			for _, IP := range IPs {
 				IP = strings.TrimSpace(IP) // 去除首尾的空白字符（空格、制表符、换行符等）
 				if IP == "" {              // 跳过空的（即开头、结尾或连续多个 ,, 的情况）
 					continue
 				}
-				ranges.parseCIDR(IP) // 解析 IP 段，获得 IP、IP 范围、子网掩码
-				if isIPv4(IP) {      // 生成要测速的所有 IPv4 / IPv6 地址（单个/随机/全部）
+				if err := ranges.parseCIDR(IP); err != nil { // 解析 IP 段，获得 IP、IP 范围、子网掩码
+					return nil, err
+				}
+				if isIPv4(IP) { // 生成要测速的所有 IPv4 / IPv6 地址（单个/随机/全部）
 					ranges.chooseIPv4()
 				} else {
 					ranges.chooseIPv6()
 				}
 			}
 	} else { // 从文件中获取 IP 段数据
-		if IPFile == "" {
-			IPFile = defaultInputFile
+		ipFile := opts.IPFile
+		if ipFile == "" {
+			ipFile = defaultInputFile
 		}
-		file, err := os.Open(IPFile)
+		file, err := os.Open(ipFile)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 		defer file.Close()
 		scanner := bufio.NewScanner(file)
@@ -310,8 +309,10 @@ func loadIPRanges() []*net.IPAddr {
 			if line == "" {                           // 跳过空行
 				continue
 			}
-			ranges.parseCIDR(line) // 解析 IP 段，获得 IP、IP 范围、子网掩码
-			if isIPv4(line) {      // 生成要测速的所有 IPv4 / IPv6 地址（单个/随机/全部）
+			if err := ranges.parseCIDR(line); err != nil { // 解析 IP 段，获得 IP、IP 范围、子网掩码
+				return nil, err
+			}
+			if isIPv4(line) { // 生成要测速的所有 IPv4 / IPv6 地址（单个/随机/全部）
 				ranges.chooseIPv4()
 			} else {
 				ranges.chooseIPv6()
@@ -324,5 +325,5 @@ func loadIPRanges() []*net.IPAddr {
 		ranges.ips = fastRandomSelect(ranges.ips, maxTestQueue)
 	}
 	
-	return ranges.ips
+	return ranges.ips, nil
 }
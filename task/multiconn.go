@@ -0,0 +1,51 @@
+package task
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const (
+	defaultConnections = 1
+	throttleRatio      = 1.5 // 多连接总速度达到单连接速度的该倍数时，认为存在单流限速
+)
+
+// 同时建立 conns 个连接对同一 IP 下载测速，返回各连接速度之和
+// 进度条带宽使用 slot ~ slot+conns-1 的并发序号
+func (t *Tester) multiDownload(ctx context.Context, ip *net.IPAddr, bar *utils.Bar, slot, conns int) float64 {
+	speeds := make([]float64, conns)
+	var wg sync.WaitGroup
+	for i := 0; i < conns; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			speeds[i], _ = t.downloadHandler(ctx, ip, bar, slot+i)
+		}(i)
+	}
+	wg.Wait()
+	var total float64
+	for _, s := range speeds {
+		total += s
+	}
+	return total
+}
+
+// 多数 IP 的多连接总速度明显高于单连接速度时，提示瓶颈在于单流限速而非 Cloudflare 节点
+func (t *Tester) warnThrottle(speedSet utils.DownloadSpeedSet) {
+	var tested, throttled int
+	for _, v := range speedSet {
+		if v.DownloadSpeed <= 0 || v.MultiSpeed <= 0 {
+			continue
+		}
+		tested++
+		if v.MultiSpeed >= v.DownloadSpeed*throttleRatio {
+			throttled++
+		}
+	}
+	if tested > 0 && throttled*2 > tested {
+		t.printf("\n[提示] %d / %d 个 IP 的多连接总速度明显高于单连接速度，单连接速度可能受运营商单流限速影响，而非节点本身较慢。\n", throttled, tested)
+	}
+}
@@ -0,0 +1,98 @@
+package task
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+// 测速阶段
+const (
+	StagePing     = "ping"
+	StageDownload = "download"
+	StageUpload   = "upload"
+	StageTrace    = "trace"
+	StageDone     = "done"
+)
+
+// 测速进度，与进度条显示的计数一致
+type Progress struct {
+	Stage     string  `json:"stage"`
+	Done      int     `json:"done"`           // 延迟测速：已测速的 IP 数量；下载测速：满足条件的 IP 数量；上传测速：已测速的 IP 数量；trace：已获取的 IP 数量
+	Total     int     `json:"total"`          // 延迟测速：IP 总数；下载测速：下载测速数量；上传测速：上传测速数量；trace：结果 IP 数量
+	Probed    int     `json:"probed"`         // 延迟测速的 IP 总数
+	Available int     `json:"available"`      // 延迟测速可用的 IP 数量
+	Bandwidth float64 `json:"bandwidth_mb_s"` // 当前下载速度 (MB/s)，并发下载测速时为总速度
+}
+
+type progress struct {
+	mu sync.Mutex
+	Progress
+	stageStart time.Time
+	durations  map[string]time.Duration
+	speeds     map[int]int64 // 各并发下载测速的当前速度 (B/s)
+}
+
+// 当前的测速进度
+func (t *Tester) Progress() Progress {
+	t.progress.mu.Lock()
+	defer t.progress.mu.Unlock()
+	return t.progress.Progress
+}
+
+// 最近一次测速各阶段的耗时
+func (t *Tester) StageDurations() map[string]time.Duration {
+	t.progress.mu.Lock()
+	defer t.progress.mu.Unlock()
+	durations := make(map[string]time.Duration, len(t.progress.durations))
+	for stage, d := range t.progress.durations {
+		durations[stage] = d
+	}
+	return durations
+}
+
+// 进入新的测速阶段，结束时保留最后的计数
+func (t *Tester) setStage(stage string, total int) {
+	t.progress.mu.Lock()
+	defer t.progress.mu.Unlock()
+	now := time.Now()
+	if stage == StagePing {
+		t.progress.durations = make(map[string]time.Duration)
+	} else if t.progress.Stage == StagePing || t.progress.Stage == StageDownload || t.progress.Stage == StageUpload || t.progress.Stage == StageTrace { // 记录上一阶段的耗时
+		t.progress.durations[t.progress.Stage] = now.Sub(t.progress.stageStart)
+	}
+	t.progress.Stage, t.progress.Bandwidth, t.progress.speeds, t.progress.stageStart = stage, 0, nil, now
+	if stage == StageDone {
+		return
+	}
+	if stage == StagePing {
+		t.progress.Probed, t.progress.Available = total, 0
+	}
+	t.progress.Done, t.progress.Total = 0, total
+}
+
+func (t *Tester) growProgress(num, available int) {
+	t.progress.mu.Lock()
+	defer t.progress.mu.Unlock()
+	t.progress.Done += num
+	if t.progress.Stage == StagePing {
+		t.progress.Available = available
+	}
+}
+
+// 更新第 slot 个下载测速的当前速度，并发下载测速时进度条显示的是总速度
+func (t *Tester) setBandwidth(bar *utils.Bar, slot int, speed int64) {
+	t.progress.mu.Lock()
+	defer t.progress.mu.Unlock()
+	if t.progress.speeds == nil {
+		t.progress.speeds = make(map[int]int64)
+	}
+	t.progress.speeds[slot] = speed
+	var total int64
+	for _, s := range t.progress.speeds {
+		total += s
+	}
+	bar.SetBandwidth(total)
+	t.progress.Bandwidth = float64(total) / 1024 / 1024
+}
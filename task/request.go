@@ -0,0 +1,71 @@
+package task
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.80 Safari/537.36"
+
+// 指定的 SNI，未指定时使用指定的 Host，均未指定时返回空（即使用请求地址的域名，重定向后也能正确匹配证书）
+func (t *Tester) customServerName() string {
+	if t.opts.SNI != "" {
+		return t.opts.SNI
+	}
+	if host, _, err := net.SplitHostPort(t.opts.Host); err == nil {
+		return host
+	}
+	return t.opts.Host
+}
+
+// TLS 握手使用的 SNI，未指定时使用测速地址的域名
+func (t *Tester) serverName() string {
+	if name := t.customServerName(); name != "" {
+		return name
+	}
+	u, err := url.Parse(t.opts.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// HTTPing、下载测速及 trace 使用的 TLS 配置
+func (t *Tester) tlsConfig() *tls.Config {
+	return &tls.Config{
+		ServerName:         t.customServerName(),
+		InsecureSkipVerify: t.opts.Insecure, // 跳过证书验证
+	}
+}
+
+// 设置 User-Agent、额外的请求头及 Host
+func (t *Tester) setRequestHeader(req *http.Request) {
+	userAgent := t.opts.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	for key, values := range t.opts.Headers {
+		req.Header.Del(key)
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if t.opts.Host != "" {
+		req.Host = t.opts.Host
+	}
+}
+
+// 解析 Name: value 格式的请求头并添加到 h 中
+func AddHeader(h http.Header, line string) error {
+	i := strings.IndexByte(line, ':')
+	if i <= 0 {
+		return fmt.Errorf("请求头格式应为 Name: value：%s", line)
+	}
+	h.Add(strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]))
+	return nil
+}
@@ -1,6 +1,7 @@
 package task
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"sort"
@@ -19,61 +20,74 @@ const (
 	defaultPingTimes  = 4
 )
 
-var (
-	Routines      = defaultRoutines
-	TCPPort   int = defaultPort
-	PingTimes int = defaultPingTimes
-)
-
 type Ping struct {
+	*Tester
+	ctx     context.Context
 	wg      *sync.WaitGroup
 	m       *sync.Mutex
 	ips     []*net.IPAddr
 	csv     utils.PingDelaySet
 	control chan bool
 	bar     *utils.Bar
+	icmp    *icmpPool // ICMP 模式下复用的套接字
 }
 
-func checkPingDefault() {
-	if Routines <= 0 {
-		Routines = defaultRoutines
+func (t *Tester) newPing(ctx context.Context) (*Ping, error) {
+	if t.opts.ICMP && !t.opts.Httping {
+		if err := checkICMP(); err != nil {
+			return nil, err
+		}
 	}
-	if TCPPort <= 0 || TCPPort >= 65535 {
-		TCPPort = defaultPort
+	if err := checkHTTP3(t.opts); err != nil {
+		return nil, err
 	}
-	if PingTimes <= 0 {
-		PingTimes = defaultPingTimes
+	ips, err := loadIPRanges(t.opts)
+	if err != nil {
+		return nil, err
 	}
-}
-
-func NewPing() *Ping {
-	checkPingDefault()
-	ips := loadIPRanges()
+	t.setStage(StagePing, len(ips))
 	return &Ping{
+		Tester:  t,
+		ctx:     ctx,
 		wg:      &sync.WaitGroup{},
 		m:       &sync.Mutex{},
 		ips:     ips,
 		csv:     make(utils.PingDelaySet, 0),
-		control: make(chan bool, Routines),
-		bar:     utils.NewBar(len(ips), "可用:", ""),
-	}
+		control: make(chan bool, t.opts.Routines),
+		bar:     t.newBar(len(ips), "可用:", ""),
+		icmp:    newICMPPool(t.opts.Routines),
+	}, nil
 }
 
 func (p *Ping) Run() utils.PingDelaySet {
 	if len(p.ips) == 0 {
 		return p.csv
 	}
-	if Httping {
-		fmt.Printf("开始延迟测速（模式：HTTP, 端口：%d, 范围：%v ~ %v ms, 丢包：%.2f)\n", TCPPort, utils.InputMinDelay.Milliseconds(), utils.InputMaxDelay.Milliseconds(), utils.InputMaxLossRate)
+	f := p.opts.Filter
+	if p.opts.Httping {
+		p.printf("开始延迟测速（模式：HTTP, 端口：%d, 范围：%v ~ %v ms, 丢包：%.2f)\n", p.opts.TCPPort, f.MinDelay.Milliseconds(), f.MaxDelay.Milliseconds(), f.MaxLossRate)
+	} else if p.opts.ICMP {
+		p.printf("开始延迟测速（模式：ICMP, 范围：%v ~ %v ms, 丢包：%.2f)\n", f.MinDelay.Milliseconds(), f.MaxDelay.Milliseconds(), f.MaxLossRate)
+	} else if p.opts.TLSPing {
+		p.printf("开始延迟测速（模式：TLS, 端口：%d, SNI：%s, 范围：%v ~ %v ms, 丢包：%.2f)\n", p.opts.TCPPort, p.serverName(), f.MinDelay.Milliseconds(), f.MaxDelay.Milliseconds(), f.MaxLossRate)
+	} else if p.opts.HTTP3 {
+		p.printf("开始延迟测速（模式：QUIC, 端口：%d, SNI：%s, 范围：%v ~ %v ms, 丢包：%.2f)\n", p.opts.TCPPort, p.serverName(), f.MinDelay.Milliseconds(), f.MaxDelay.Milliseconds(), f.MaxLossRate)
 	} else {
-		fmt.Printf("开始延迟测速（模式：TCP, 端口：%d, 范围：%v ~ %v ms, 丢包：%.2f)\n", TCPPort, utils.InputMinDelay.Milliseconds(), utils.InputMaxDelay.Milliseconds(), utils.InputMaxLossRate)
+		p.printf("开始延迟测速（模式：TCP, 端口：%d, 范围：%v ~ %v ms, 丢包：%.2f)\n", p.opts.TCPPort, f.MinDelay.Milliseconds(), f.MaxDelay.Milliseconds(), f.MaxLossRate)
+	}
+	if !p.opts.Httping && !p.opts.ColoTrace && p.colos != nil {
+		p.printf("[信息] 已指定数据中心筛选条件，将额外通过 /cdn-cgi/trace 获取各 IP 的数据中心。\n")
 	}
 	for _, ip := range p.ips {
+		if p.ctx.Err() != nil { // 已取消时不再开始新的测速
+			break
+		}
 		p.wg.Add(1)
 		p.control <- false
 		go p.start(ip)
 	}
 	p.wg.Wait()
+	p.icmp.close()
 	p.bar.Done()
 	sort.Sort(p.csv)
 	return p.csv
@@ -90,11 +104,11 @@ func (p *Ping) tcping(ip *net.IPAddr) (bool, time.Duration) {
 	startTime := time.Now()
 	var fullAddress string
 	if isIPv4(ip.String()) {
-		fullAddress = fmt.Sprintf("%s:%d", ip.String(), TCPPort)
+		fullAddress = fmt.Sprintf("%s:%d", ip.String(), p.opts.TCPPort)
 	} else {
-		fullAddress = fmt.Sprintf("[%s]:%d", ip.String(), TCPPort)
+		fullAddress = fmt.Sprintf("[%s]:%d", ip.String(), p.opts.TCPPort)
 	}
-	conn, err := net.DialTimeout("tcp", fullAddress, tcpConnectTimeout)
+	conn, err := (&net.Dialer{Timeout: tcpConnectTimeout}).DialContext(p.ctx, "tcp", fullAddress)
 	if err != nil {
 		return false, 0
 	}
@@ -103,45 +117,67 @@ func (p *Ping) tcping(ip *net.IPAddr) (bool, time.Duration) {
 	return true, duration
 }
 
-// pingReceived pingTotalTime
-func (p *Ping) checkConnection(ip *net.IPAddr) (recv int, totalDelay time.Duration) {
-	if Httping {
-		recv, totalDelay = p.httping(ip)
-		return
+// 返回每次成功测速的延迟、各阶段耗时（仅 HTTPing/TLS 模式）及数据中心（机场三字码）
+func (p *Ping) checkConnection(ip *net.IPAddr) (delays []time.Duration, phases []utils.DelayPhases, colo string) {
+	if p.opts.Httping {
+		return p.httping(ip)
+	}
+	for i := 0; i < p.opts.PingTimes; i++ {
+		ok, delay := false, time.Duration(0)
+		switch {
+		case p.opts.ICMP:
+			ok, delay = p.icmping(ip)
+		case p.opts.TLSPing:
+			var phase utils.DelayPhases
+			if ok, phase = p.tlsping(ip); ok {
+				delay = phase.Connect + phase.TLS
+				phases = append(phases, phase)
+			}
+		case p.opts.HTTP3:
+			ok, delay = p.quicping(ip)
+		default:
+			ok, delay = p.tcping(ip)
+		}
+		if ok {
+			delays = append(delays, delay)
+		}
 	}
-	for i := 0; i < PingTimes; i++ {
-		if ok, delay := p.tcping(ip); ok {
-			recv++
-			totalDelay += delay
+	// TCPing/ICMP/TLS/QUIC 模式下只能通过 trace 获取数据中心，指定了筛选条件时即使未启用 ColoTrace 也需获取
+	if (p.opts.ColoTrace || p.colos != nil) && len(delays) > 0 {
+		colo = p.traceColo(p.ctx, ip)
+		if p.colos != nil && !p.matchColo(colo) {
+			return nil, nil, ""
 		}
 	}
 	return
 }
 
-func (p *Ping) appendIPData(data *utils.PingData) {
+func (p *Ping) appendIPData(data *utils.PingData, colo string) {
 	p.m.Lock()
 	defer p.m.Unlock()
 	p.csv = append(p.csv, utils.CloudflareIPData{
-		PingData: data,
+		PingData:   data,
+		Datacenter: colo,
 	})
 }
 
 // handle tcping
 func (p *Ping) tcpingHandler(ip *net.IPAddr) {
-	recv, totalDlay := p.checkConnection(ip)
+	delays, phases, colo := p.checkConnection(ip)
 	nowAble := len(p.csv)
-	if recv != 0 {
+	if len(delays) != 0 {
 		nowAble++
 	}
 	p.bar.Grow(1, strconv.Itoa(nowAble))
-	if recv == 0 {
+	p.growProgress(1, nowAble)
+	if len(delays) == 0 {
 		return
 	}
 	data := &utils.PingData{
-		IP:       ip,
-		Sended:   PingTimes,
-		Received: recv,
-		Delay:    totalDlay / time.Duration(recv),
+		IP:     ip,
+		Sended: p.opts.PingTimes,
 	}
-	p.appendIPData(data)
+	data.SetDelays(delays)
+	data.SetPhases(phases)
+	p.appendIPData(data, colo)
 }
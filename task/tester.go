@@ -0,0 +1,246 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+// 测速配置，应以 DefaultOptions 的返回值为基础修改
+type Options struct {
+	Routines  int    // 延迟测速线程
+	PingTimes int    // 单个 IP 延迟测速次数
+	TCPPort   int    // 延迟测速/下载测速使用的端口
+	URL       string // 延迟测速(HTTPing)/下载测速使用的地址
+
+	Httping   bool // 延迟测速改为 HTTP 协议
+	ICMP      bool // 延迟测速改为 ICMP 协议，与 Httping 同时指定时以 Httping 为准
+	TLSPing   bool // 延迟测速改为 TLS 握手，延迟为连接及握手的总耗时，优先级低于 Httping、ICMP
+	HTTP3     bool // 延迟测速改为 QUIC 握手（优先级低于以上模式），下载测速改为 HTTP/3，需已通过 RegisterHTTP3 注册实现
+	ColoTrace bool // TCPing/ICMP/TLS/QUIC 模式下通过 /cdn-cgi/trace 获取数据中心，指定了数据中心筛选条件时自动启用
+	Trace     bool // 测速完成后通过 /cdn-cgi/trace 获取最终结果中各 IP 的信息（数据中心、客户端 IP 等）
+
+	// 数据中心筛选条件，非 HTTPing 模式下会自动启用 ColoTrace，均为英文逗号分隔，匹配任一条件即可
+	HttpingCFColo  string // 匹配指定地区（机场三字码），为空时不限
+	ColoCountries  string // 匹配指定国家/地区（ISO 3166-1 两位代码，如 JP）
+	ColoContinents string // 匹配指定大洲（AF、AS、EU、NA、SA、OC）
+	ColoExclude    string // 排除指定地区（机场三字码），优先于以上条件
+
+	// HTTPing 有效响应的判断规则，每次测速的响应均需满足才算接收
+	HttpingStatusCode string      // 有效状态码，英文逗号分隔，可为范围（如 200-299），为空时为 200、301、302
+	HttpingHeaders    http.Header // 响应需包含的响应头，值不为空时响应头的值需包含该值（不区分大小写）
+	HttpingBody       string      // 响应内容需匹配的正则表达式，指定后改为 GET 请求
+
+	// 以下请求配置用于 TLS 延迟测速、HTTPing、trace 及下载测速
+	Host      string      // HTTP 请求的 Host 头，为空时使用 URL 的域名
+	SNI       string      // TLS 握手使用的 SNI，为空时使用 Host，均未指定时使用 URL 的域名
+	UserAgent string      // 为空时使用默认的浏览器 User-Agent
+	Headers   http.Header // 额外的请求头
+	Insecure  bool        // 跳过证书验证
+
+	IPFile      string // IP 段数据文件
+	IPText      string // IP 段数据，英文逗号分隔，指定后不再读取 IPFile
+	TestAll4    bool   // 测速全部的 IPv4
+	IPv4TestNum int    // 每个 IPv4 段的测速数量，为 0 时每 /24 随机一个
+	IPv6TestNum int    // 每个 IPv6 段的测速数量，为 0 时随机一个
+
+	Filter utils.Filter // 延迟测速结果的过滤条件
+	SortBy string       // 延迟测速结果的排序依据（丢包率相同时），见 utils.SortDelay 等，为空时按平均延迟
+
+	TestCount int           // 下载测速数量
+	Timeout   time.Duration // 单个 IP 下载测速最长时间
+	MinSpeed  float64       // 下载速度下限 (MB/s)
+	Disable   bool          // 禁用下载测速，结果按延迟排序
+
+	// 并发下载测速时各 IP 共享本机带宽，总带宽不足时测得的单个 IP 速度会偏低
+	DownloadRoutines int  // 下载测速并发数，为 1 时逐个测速
+	TestCapacity     bool // 并发下载测速前先测量单线程及并发的总下载速度，并发会拉低单个 IP 速度时给出提示
+	Connections      int  // 单个 IP 下载测速的连接数，大于 1 时在单连接测速后另测多连接的总速度，用于区分单流限速
+
+	// 上传测速，在下载测速后对结果中的 IP 逐个上传测速，单个 IP 最长时间同 Timeout
+	UploadURL      string  // 上传测速地址（POST），为空时不进行上传测速
+	UploadSize     int64   // 单个 IP 上传的数据大小 (B)
+	MinUploadSpeed float64 // 上传速度下限 (MB/s)
+	SortByUpload   bool    // 结果改为按上传速度排序
+
+	Score string // 综合评分规则（权重或表达式，见 utils.Scorer），指定后最终结果按评分排序，优先于其他排序方式
+
+	Quiet bool // 不输出测速过程信息及进度条（作为库使用时）
+}
+
+// 默认的测速配置
+func DefaultOptions() Options {
+	return Options{
+		Routines:  defaultRoutines,
+		PingTimes: defaultPingTimes,
+		TCPPort:   defaultPort,
+		URL:       defaultURL,
+		IPFile:    defaultInputFile,
+		Filter:    utils.DefaultFilter(),
+		TestCount: defaultTestNum,
+		Timeout:   defaultTimeout,
+		MinSpeed:  defaultMinSpeed,
+		Disable:   defaultDisableDownload,
+
+		DownloadRoutines: defaultDownloadRoutines,
+		Connections:      defaultConnections,
+		UploadSize:       defaultUploadSize,
+	}
+}
+
+func (o *Options) checkDefault() {
+	if o.Routines <= 0 {
+		o.Routines = defaultRoutines
+	}
+	if o.TCPPort <= 0 || o.TCPPort >= 65535 {
+		o.TCPPort = defaultPort
+	}
+	if o.PingTimes <= 0 {
+		o.PingTimes = defaultPingTimes
+	}
+	if o.URL == "" {
+		o.URL = defaultURL
+	}
+	if o.IPFile == "" {
+		o.IPFile = defaultInputFile
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaultTimeout
+	}
+	if o.TestCount <= 0 {
+		o.TestCount = defaultTestNum
+	}
+	if o.MinSpeed <= 0.0 {
+		o.MinSpeed = defaultMinSpeed
+	}
+	if o.DownloadRoutines <= 0 {
+		o.DownloadRoutines = defaultDownloadRoutines
+	}
+	if o.Connections <= 0 {
+		o.Connections = defaultConnections
+	}
+	if o.UploadSize <= 0 {
+		o.UploadSize = defaultUploadSize
+	}
+}
+
+// 测速器，各测速步骤只使用自身的配置，多个测速器可同时使用
+type Tester struct {
+	opts     Options
+	colos    *coloFilter // 数据中心筛选条件，为 nil 时不限
+	rule     *httpingRule
+	scorer   *utils.Scorer // 为 nil 时不评分
+	progress progress
+}
+
+// 以指定配置创建测速器，配置有误（见 CheckOptions）时返回错误
+func NewTester(opts Options) (*Tester, error) {
+	opts.checkDefault()
+	if err := CheckOptions(opts); err != nil {
+		return nil, err
+	}
+	rule, err := newHttpingRule(opts)
+	if err != nil {
+		return nil, err
+	}
+	scorer, err := utils.ParseScorer(opts.Score)
+	if err != nil {
+		return nil, err
+	}
+	return &Tester{opts: opts, colos: newColoFilter(opts), rule: rule, scorer: scorer}, nil
+}
+
+// 检查测速配置中需解析的参数（HTTPing 规则、数据中心筛选条件、排序依据、评分规则）是否有效，及是否支持 HTTP3 模式
+func CheckOptions(o Options) error {
+	if _, err := newHttpingRule(o); err != nil {
+		return err
+	}
+	if err := checkColoFilter(o); err != nil {
+		return err
+	}
+	if err := checkHTTP3(o); err != nil {
+		return err
+	}
+	if err := utils.CheckSortKey(o.SortBy); err != nil {
+		return err
+	}
+	_, err := utils.ParseScorer(o.Score)
+	return err
+}
+
+// 实际使用的测速配置（已填充默认值）
+func (t *Tester) Options() Options {
+	return t.opts
+}
+
+// 当前的延迟测速模式
+func (t *Tester) Mode() string {
+	if t.opts.Httping {
+		return "httping"
+	}
+	if t.opts.ICMP {
+		return "icmp"
+	}
+	if t.opts.TLSPing {
+		return "tls"
+	}
+	if t.opts.HTTP3 {
+		return "http3"
+	}
+	return "tcping"
+}
+
+// 依次进行延迟测速、过滤、下载测速（及上传测速、评分排序、获取 trace 信息），ctx 取消时返回已有的结果及 ctx.Err()
+func (t *Tester) Run(ctx context.Context) (utils.DownloadSpeedSet, error) {
+	defer t.setStage(StageDone, 0)
+	pingData, err := t.Ping(ctx)
+	if err != nil {
+		return utils.DownloadSpeedSet(pingData), err
+	}
+	speedData, err := t.TestDownloadSpeed(ctx, t.FilterDelay(pingData))
+	if err != nil {
+		return speedData, err
+	}
+	if speedData, err = t.TestUploadSpeed(ctx, speedData); err != nil {
+		return speedData, err
+	}
+	t.scorer.Sort(speedData)
+	if !t.opts.Trace {
+		return speedData, nil
+	}
+	return speedData, t.TraceResults(ctx, speedData)
+}
+
+// 延迟测速，结果按丢包率、延迟排序
+func (t *Tester) Ping(ctx context.Context) (utils.PingDelaySet, error) {
+	p, err := t.newPing(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.Run(), ctx.Err()
+}
+
+// 以延迟、丢包、延迟分布条件过滤延迟测速结果，并按 SortBy 排序
+func (t *Tester) FilterDelay(s utils.PingDelaySet) utils.PingDelaySet {
+	f := t.opts.Filter
+	s = s.FilterDelay(f).FilterLossRate(f).FilterDelayStats(f)
+	s.SortBy(t.opts.SortBy)
+	return s
+}
+
+func (t *Tester) printf(format string, a ...interface{}) {
+	if !t.opts.Quiet {
+		fmt.Printf(format, a...)
+	}
+}
+
+// Quiet 时返回 nil，即不显示进度条
+func (t *Tester) newBar(count int, myStrStart, myStrEnd string) *utils.Bar {
+	if t.opts.Quiet {
+		return nil
+	}
+	return utils.NewBar(count, myStrStart, myStrEnd)
+}
@@ -0,0 +1,69 @@
+package task
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// NewTester 与 CheckOptions 的检查一致，配置有误时不创建测速器
+func TestNewTesterCheckOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *Options)
+		err    string // 为空时应创建成功
+	}{
+		{"默认配置", func(o *Options) {}, ""},
+		{"未注册 HTTP3", func(o *Options) { o.HTTP3 = true }, errNoHTTP3.Error()},
+		{"状态码", func(o *Options) { o.Httping = true; o.HttpingStatusCode = "abc" }, "abc"},
+		{"响应内容正则", func(o *Options) { o.HttpingBody = "(" }, "无效的响应内容正则表达式"},
+		{"大洲代码", func(o *Options) { o.ColoContinents = "XX" }, "无效的大洲代码 [XX]"},
+		{"排序依据", func(o *Options) { o.SortBy = "speed" }, "不支持的排序依据 [speed]"},
+		{"评分规则", func(o *Options) { o.Score = "speed*" }, "speed*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(&opts)
+			tester, err := NewTester(opts)
+			if tt.err == "" {
+				if err != nil || tester == nil {
+					t.Fatalf("NewTester 失败：%v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("错误 = %v，应包含 %q", err, tt.err)
+			}
+			if tester != nil {
+				t.Error("配置有误时不应返回测速器")
+			}
+			if checkErr := CheckOptions(opts); checkErr == nil || checkErr.Error() != err.Error() {
+				t.Errorf("CheckOptions 的错误 = %v，应与 NewTester 一致", checkErr)
+			}
+		})
+	}
+}
+
+// 未注册 HTTP/3 实现时，即使绕过 NewTester 的检查也不会使用空的实现
+func TestNoHTTP3Transport(t *testing.T) {
+	opts := DefaultOptions()
+	opts.checkDefault()
+	opts.HTTP3 = true
+	tester := &Tester{opts: opts}
+	ip := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+
+	transport, closeTransport := tester.downloadTransport(ip)
+	defer closeTransport()
+	req, _ := http.NewRequest(http.MethodGet, "https://127.0.0.1/", nil)
+	if _, err := transport.RoundTrip(req); !errors.Is(err, errNoHTTP3) {
+		t.Errorf("下载测速的错误 = %v，应为 %v", err, errNoHTTP3)
+	}
+
+	p := &Ping{Tester: tester}
+	if ok, _ := p.quicping(ip); ok {
+		t.Error("未注册 HTTP/3 实现时 QUIC 握手不应成功")
+	}
+}
@@ -0,0 +1,37 @@
+package task
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const tlsHandshakeTimeout = time.Second * 2
+
+// 建立 TCP 连接后进行完整的 TLS 握手（未指定 Insecure 时校验证书），分别返回连接耗时及握手耗时
+func (p *Ping) tlsping(ip *net.IPAddr) (bool, utils.DelayPhases) {
+	startTime := time.Now()
+	address := net.JoinHostPort(ip.String(), strconv.Itoa(p.opts.TCPPort))
+	conn, err := (&net.Dialer{Timeout: tcpConnectTimeout}).DialContext(p.ctx, "tcp", address)
+	if err != nil {
+		return false, utils.DelayPhases{}
+	}
+	defer conn.Close()
+	connectTime := time.Now()
+	if err = conn.SetDeadline(connectTime.Add(tlsHandshakeTimeout)); err != nil {
+		return false, utils.DelayPhases{}
+	}
+	config := p.tlsConfig()
+	config.ServerName = p.serverName()
+	tlsConn := tls.Client(conn, config)
+	if err = tlsConn.Handshake(); err != nil {
+		return false, utils.DelayPhases{}
+	}
+	return true, utils.DelayPhases{
+		Connect: connectTime.Sub(startTime),
+		TLS:     time.Since(connectTime),
+	}
+}
@@ -0,0 +1,147 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const (
+	tracePath      = "/cdn-cgi/trace"
+	traceTimeout   = time.Second * 2
+	traceBodyLimit = 4096 // trace 返回内容很短，限制读取大小以防异常响应
+)
+
+// 通过指定 IP 访问 [-url] 所在域名的 /cdn-cgi/trace，返回解析后的键值对（如 colo=SJC）
+func (t *Tester) trace(ctx context.Context, ip *net.IPAddr) map[string]string {
+	u, err := url.Parse(t.opts.URL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	hc := http.Client{
+		Timeout:   traceTimeout,
+		Transport: &http.Transport{DialContext: t.dialContext(ip), TLSClientConfig: t.tlsConfig()},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse // 阻止重定向
+		},
+	}
+	requ, err := http.NewRequestWithContext(ctx, http.MethodGet, u.Scheme+"://"+u.Host+tracePath, nil)
+	if err != nil {
+		return nil
+	}
+	t.setRequestHeader(requ)
+	resp, err := hc.Do(requ)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil
+	}
+	return parseTrace(io.LimitReader(resp.Body, traceBodyLimit))
+}
+
+// 解析 trace 内容，每行格式为 key=value
+func parseTrace(r io.Reader) map[string]string {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, '='); i > 0 {
+			fields[line[:i]] = line[i+1:]
+		}
+	}
+	return fields
+}
+
+// 通过 /cdn-cgi/trace 获取该 IP 的数据中心（机场三字码）
+func (t *Tester) traceColo(ctx context.Context, ip *net.IPAddr) string {
+	return strings.ToUpper(t.trace(ctx, ip)["colo"])
+}
+
+// 通过各 IP 访问 /cdn-cgi/trace，记录实际的数据中心、客户端 IP、HTTP/TLS 版本及 WARP 状态，
+// 用于确认实际提供服务的数据中心，以及发现路径上的透明代理；ctx 取消时返回 ctx.Err()
+func (t *Tester) TraceResults(ctx context.Context, data utils.DownloadSpeedSet) error {
+	if len(data) == 0 {
+		return nil
+	}
+	t.printf("\n开始获取 trace 信息（数量：%d）\n", len(data))
+	bar := t.newBar(len(data), "成功:", "")
+	t.setStage(StageTrace, len(data))
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		control   = make(chan struct{}, t.opts.Routines)
+	)
+	for i := range data {
+		if ctx.Err() != nil { // 已取消时不再继续获取
+			break
+		}
+		wg.Add(1)
+		control <- struct{}{}
+		go func(cf *utils.CloudflareIPData) {
+			defer wg.Done()
+			defer func() { <-control }()
+			fields := t.trace(ctx, cf.IP)
+			cf.Trace = utils.TraceInfo{
+				Colo:        strings.ToUpper(fields["colo"]),
+				ClientIP:    fields["ip"],
+				HTTPVersion: fields["http"],
+				TLSVersion:  fields["tls"],
+				Warp:        fields["warp"],
+			}
+			if cf.Datacenter == "" { // 测速时未获取到数据中心时，以 trace 为准
+				cf.Datacenter = cf.Trace.Colo
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if cf.Trace != (utils.TraceInfo{}) {
+				succeeded++
+			}
+			bar.Grow(1, strconv.Itoa(succeeded))
+			t.growProgress(1, 0)
+		}(&data[i])
+	}
+	wg.Wait()
+	bar.Done()
+	t.warnTrace(data)
+	return ctx.Err()
+}
+
+// 各 IP 的客户端 IP 不一致，或 trace 的数据中心与测速时获取的不一致时，提示可能经过了代理
+// （双栈网络中 IPv4 与 IPv6 的客户端 IP 本就不同，客户端 IP 只在同一地址族内比较）
+func (t *Tester) warnTrace(data utils.DownloadSpeedSet) {
+	var warnings []string
+	clientIPs := make(map[bool]string) // 是否为 IPv4 -> 首个客户端 IP
+	for _, v := range data {
+		if v.Trace.ClientIP == "" {
+			continue
+		}
+		ipv4 := isIPv4(v.Trace.ClientIP)
+		if clientIP, ok := clientIPs[ipv4]; !ok {
+			clientIPs[ipv4] = v.Trace.ClientIP
+		} else if v.Trace.ClientIP != clientIP {
+			warnings = append(warnings, fmt.Sprintf("[提示] 通过不同 IP 访问时 Cloudflare 看到的客户端 IP 不同（%s、%s），路径上可能存在透明代理或多出口网络。", clientIP, v.Trace.ClientIP))
+			break
+		}
+	}
+	for _, v := range data {
+		if v.Trace.Colo != "" && v.Datacenter != "" && v.Trace.Colo != v.Datacenter {
+			warnings = append(warnings, fmt.Sprintf("[提示] IP %s 测速时的数据中心为 %s，但 trace 返回 %s，路径上可能存在透明代理。", v.IP.String(), v.Datacenter, v.Trace.Colo))
+		}
+	}
+	if len(warnings) > 0 {
+		t.printf("\n%s\n", strings.Join(warnings, "\n"))
+	}
+}
@@ -0,0 +1,181 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+	"github.com/VividCortex/ewma"
+)
+
+const (
+	defaultUploadSize int64 = 10 * 1024 * 1024
+	uploadChunkSize         = 64 * 1024
+)
+
+// 上传测速，对下载测速的结果（禁用下载测速时为延迟最低的 [下载测速数量] 个 IP）逐个上传测速，
+// 未指定 UploadURL 时直接返回；ctx 取消时返回已有的结果及 ctx.Err()
+func (t *Tester) TestUploadSpeed(ctx context.Context, speedSet utils.DownloadSpeedSet) (utils.DownloadSpeedSet, error) {
+	if t.opts.UploadURL == "" || len(speedSet) == 0 {
+		return speedSet, nil
+	}
+	if len(speedSet) > t.opts.TestCount {
+		speedSet = speedSet[:t.opts.TestCount]
+	}
+
+	t.printf("\n开始上传测速（下限：%.2f MB/s, 大小：%.2f MB, 数量：%d）\n", t.opts.MinUploadSpeed, float64(t.opts.UploadSize)/1024/1024, len(speedSet))
+	bar_a := len(strconv.Itoa(len(speedSet)))
+	bar_b := "     "
+	for i := 0; i < bar_a; i++ {
+		bar_b += " "
+	}
+	bar := t.newBar(len(speedSet), bar_b, "")
+	t.setStage(StageUpload, len(speedSet))
+	var (
+		uploadSet utils.DownloadSpeedSet
+		err       error
+	)
+	for i := range speedSet {
+		if err = ctx.Err(); err != nil { // 已取消时不再继续测速
+			break
+		}
+		speedSet[i].UploadSpeed = t.uploadHandler(ctx, speedSet[i].IP, bar)
+		bar.Grow(1, "")
+		t.growProgress(1, 0)
+		// 以 [上传速度下限] 条件过滤结果
+		if speedSet[i].UploadSpeed >= t.opts.MinUploadSpeed*1024*1024 {
+			uploadSet = append(uploadSet, speedSet[i])
+		}
+	}
+	bar.Done()
+	if len(uploadSet) == 0 { // 没有符合速度限制的数据，返回所有测试数据
+		uploadSet = speedSet
+	}
+	if t.opts.SortByUpload {
+		sort.SliceStable(uploadSet, func(i, j int) bool { return uploadSet[i].UploadSpeed > uploadSet[j].UploadSpeed })
+	}
+	return uploadSet, err
+}
+
+// 通过指定 IP 向 UploadURL 以 POST 上传 UploadSize 大小的随机数据，与下载测速同样以 EWMA 计算速度
+func (t *Tester) uploadHandler(ctx context.Context, ip *net.IPAddr, bar *utils.Bar) float64 {
+	timeout := t.opts.Timeout
+	// 到达下载测速时间后中断上传，已上传部分的速度仍然有效
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	body := newUploadBody(t.opts.UploadSize, timeout, func(speed int64) { t.setBandwidth(bar, 0, speed) })
+	defer t.setBandwidth(bar, 0, 0)
+
+	client := &http.Client{
+		Transport: &http.Transport{DialContext: t.dialContext(ip), TLSClientConfig: t.tlsConfig()},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse // 重定向后无法重新上传
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.opts.UploadURL, body)
+	if err != nil {
+		return 0.0
+	}
+	req.ContentLength = t.opts.UploadSize
+	t.setRequestHeader(req)
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	response, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded { // 上传超时时以已上传的部分计算速度
+			return body.speed()
+		}
+		return 0.0
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, bufferSize))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return 0.0
+	}
+	return body.speed()
+}
+
+// 上传的请求体，在被读取时按时间片统计上传速度（即写入连接的速度，与实际发出的数据相差一个发送缓冲区）
+type uploadBody struct {
+	mu        sync.Mutex // 超时中断时读取可能仍在进行
+	remaining int64
+	done      bool
+	chunk     *bytes.Reader
+	data      []byte
+	report    func(speed int64)
+
+	timeout         time.Duration
+	timeStart       time.Time
+	timeSlice       time.Duration
+	timeCounter     int
+	nextTime        time.Time
+	contentRead     int64
+	lastContentRead int64
+	e               ewma.MovingAverage
+}
+
+func newUploadBody(size int64, timeout time.Duration, report func(speed int64)) *uploadBody {
+	data := make([]byte, uploadChunkSize)
+	rand.Read(data) // 随机数据，避免被压缩
+	return &uploadBody{
+		remaining: size,
+		chunk:     bytes.NewReader(data),
+		data:      data,
+		report:    report,
+		timeout:   timeout,
+		timeSlice: timeout / 100,
+		e:         ewma.NewMovingAverage(),
+	}
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return 0, io.EOF
+	}
+	currentTime := time.Now()
+	if b.timeStart.IsZero() { // 开始读取时才开始计时
+		b.timeStart, b.timeCounter = currentTime, 1
+		b.nextTime = b.timeStart.Add(b.timeSlice)
+	}
+	if currentTime.After(b.nextTime) {
+		b.timeCounter++
+		b.nextTime = b.timeStart.Add(b.timeSlice * time.Duration(b.timeCounter))
+		b.e.Add(float64(b.contentRead - b.lastContentRead))
+		b.report(int64(b.e.Value() / (b.timeout.Seconds() / 120)))
+		b.lastContentRead = b.contentRead
+	}
+	if b.remaining <= 0 {
+		// 获取上个时间片，以最后不完整的时间片计算速度
+		lastTimeSlice := b.timeStart.Add(b.timeSlice * time.Duration(b.timeCounter-1))
+		b.e.Add(float64(b.contentRead-b.lastContentRead) / (float64(currentTime.Sub(lastTimeSlice)) / float64(b.timeSlice)))
+		b.lastContentRead, b.done = b.contentRead, true
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	if b.chunk.Len() == 0 {
+		b.chunk.Reset(b.data)
+	}
+	n, _ := b.chunk.Read(p)
+	b.remaining -= int64(n)
+	b.contentRead += int64(n)
+	return n, nil
+}
+
+// 上传速度 (B/s)
+func (b *uploadBody) speed() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.e.Value() / (b.timeout.Seconds() / 120)
+}
@@ -0,0 +1,124 @@
+package task
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const httpingBodyLimit = 64 * 1024 // 匹配响应内容时最多读取的大小
+
+// 状态码范围（含两端）
+type codeRange struct {
+	min, max int
+}
+
+// 默认只认为 200、301、302 才算 HTTPing 通过
+var defaultStatusCodes = []codeRange{{200, 200}, {301, 302}}
+
+// HTTPing 有效响应的判断规则
+type httpingRule struct {
+	codes   []codeRange
+	headers http.Header
+	body    *regexp.Regexp // 为 nil 时不检查响应内容
+}
+
+// 解析状态码，如 200,301-302,400-499，为空（或旧版的 0）时为默认的 200、301、302
+func parseStatusCodes(spec string) ([]codeRange, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "0" {
+		return defaultStatusCodes, nil
+	}
+	var codes []codeRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		minCode, maxCode := part, part
+		if i := strings.IndexByte(part, '-'); i > 0 {
+			minCode, maxCode = part[:i], part[i+1:]
+		}
+		low, err1 := strconv.Atoi(strings.TrimSpace(minCode))
+		high, err2 := strconv.Atoi(strings.TrimSpace(maxCode))
+		if err1 != nil || err2 != nil || low < 100 || high > 599 || low > high {
+			return nil, fmt.Errorf("无效的 HTTP 状态码 [%s]", part)
+		}
+		codes = append(codes, codeRange{low, high})
+	}
+	return codes, nil
+}
+
+func newHttpingRule(o Options) (*httpingRule, error) {
+	codes, err := parseStatusCodes(o.HttpingStatusCode)
+	if err != nil {
+		return nil, err
+	}
+	rule := &httpingRule{codes: codes, headers: o.HttpingHeaders}
+	if o.HttpingBody != "" {
+		if rule.body, err = regexp.Compile(o.HttpingBody); err != nil {
+			return nil, fmt.Errorf("无效的响应内容正则表达式 [%s]：%v", o.HttpingBody, err)
+		}
+	}
+	return rule, nil
+}
+
+// 需要匹配响应内容时使用 GET 请求，否则使用 HEAD 请求
+func (r *httpingRule) method() string {
+	if r.body != nil {
+		return http.MethodGet
+	}
+	return http.MethodHead
+}
+
+// 检查状态码、响应头及响应内容，响应内容只读取前 httpingBodyLimit 字节
+func (r *httpingRule) match(resp *http.Response) bool {
+	if !r.matchCode(resp.StatusCode) {
+		return false
+	}
+	for name, values := range r.headers {
+		if !matchHeader(resp.Header.Values(name), values) {
+			return false
+		}
+	}
+	if r.body == nil {
+		return true
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, httpingBodyLimit))
+	if err != nil {
+		return false
+	}
+	return r.body.Match(body)
+}
+
+func (r *httpingRule) matchCode(code int) bool {
+	for _, c := range r.codes {
+		if code >= c.min && code <= c.max {
+			return true
+		}
+	}
+	return false
+}
+
+// 响应头需存在，指定了值时需有一个值包含指定的值（不区分大小写）
+func matchHeader(got, want []string) bool {
+	if len(got) == 0 {
+		return false
+	}
+	for _, w := range want {
+		if w == "" {
+			continue
+		}
+		found := false
+		for _, g := range got {
+			if strings.Contains(strings.ToLower(g), strings.ToLower(w)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package task
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	tests := []struct {
+		spec  string
+		codes []codeRange // 为 nil 时应报错
+	}{
+		{"", defaultStatusCodes},
+		{"0", defaultStatusCodes}, // 旧版的 0 即默认
+		{" 0 ", defaultStatusCodes},
+		{"200", []codeRange{{200, 200}}},
+		{"204,304", []codeRange{{204, 204}, {304, 304}}},
+		{"200-299", []codeRange{{200, 299}}},
+		{" 200 - 299 , 404 ", []codeRange{{200, 299}, {404, 404}}},
+		{"100-599", []codeRange{{100, 599}}},
+		{"301-301", []codeRange{{301, 301}}},
+		{"abc", nil},
+		{"200,", nil},
+		{"200,,301", nil},
+		{"99", nil},
+		{"600", nil},
+		{"200-600", nil},
+		{"299-200", nil},
+		{"-200", nil},
+		{"200-", nil},
+		{"200-300-400", nil},
+		{"2xx", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			codes, err := parseStatusCodes(tt.spec)
+			if tt.codes == nil {
+				if err == nil {
+					t.Errorf("应报错，实际为 %v", codes)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(codes, tt.codes) {
+				t.Errorf("结果 = %v %v，应为 %v", codes, err, tt.codes)
+			}
+		})
+	}
+}
+
+func TestMatchCode(t *testing.T) {
+	tests := []struct {
+		spec  string
+		match []int
+		miss  []int
+	}{
+		{"", []int{200, 301, 302}, []int{204, 303, 404}},
+		{"200-299,404", []int{200, 204, 299, 404}, []int{199, 300, 403, 405}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			rule, err := newHttpingRule(Options{HttpingStatusCode: tt.spec})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, code := range tt.match {
+				if !rule.matchCode(code) {
+					t.Errorf("状态码 %d 应有效", code)
+				}
+			}
+			for _, code := range tt.miss {
+				if rule.matchCode(code) {
+					t.Errorf("状态码 %d 应无效", code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/history"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/task"
+	"github.com/GuangYu-yu/CloudflareSpeedTest/utils"
+)
+
+const trendsCommand = "trends" // 查询历史趋势的子命令
+
+const trendsHelp = `
+用法：cfst trends [参数]
+    查询 [-history] 目录中保存的测速历史，统计各 IP 或各数据中心最近若干次测速的表现，
+    结果按稳定性（满足测速条件的比例）、中位下载速度、中位延迟排序，便于优先选择长期稳定的 IP。
+
+参数：
+    -history history
+        历史记录目录；与测速时的 [-history] 一致；(默认 history)
+    -by ip
+        分组方式；可选 ip、colo (数据中心)；(默认 ip)
+    -runs 10
+        统计最近的测速次数；为 0 时统计 [-days] 内的全部测速；(默认 10 次)
+    -days 30
+        读取最近几天的历史记录；(默认 30 天)
+    -ip 1.1.1.1
+        只显示指定 IP 或数据中心 (按 [-by] 分组)；(默认 全部)
+    -n 20
+        显示结果数量；为 0 时显示全部；(默认 20 个)
+    -json
+        以 JSON 格式输出；(默认 表格)
+`
+
+var historyStore *history.Store // 测速历史记录，为 nil 时不记录
+
+// 将测速结果追加到历史记录中
+func recordHistory(speedData utils.DownloadSpeedSet, info *utils.RunInfo, opts task.Options) {
+	if historyStore == nil || len(speedData) == 0 {
+		return
+	}
+	good := func(cf *utils.CloudflareIPData) bool {
+		if cf.Sended == 0 || cf.Received < cf.Sended {
+			return false
+		}
+		return opts.Disable || cf.DownloadSpeed > 0 && cf.DownloadSpeed >= opts.MinSpeed*1024*1024
+	}
+	if err := historyStore.Append(info, speedData, good); err != nil {
+		log.Printf("[错误] %v", err)
+	}
+}
+
+// cfst trends 子命令
+func runTrends(args []string) {
+	fs := flag.NewFlagSet(trendsCommand, flag.ExitOnError)
+	dir := fs.String("history", "history", "历史记录目录")
+	by := fs.String("by", history.ByIP, "分组方式")
+	runs := fs.Int("runs", 10, "统计最近的测速次数")
+	days := fs.Int("days", 30, "读取最近几天的历史记录")
+	only := fs.String("ip", "", "只显示指定 IP 或数据中心")
+	num := fs.Int("n", 20, "显示结果数量")
+	asJSON := fs.Bool("json", false, "以 JSON 格式输出")
+	fs.Usage = func() { fmt.Print(trendsHelp) }
+	_ = fs.Parse(args)
+	if *by != history.ByIP && *by != history.ByColo {
+		log.Fatalf("[错误] 不支持的分组方式 [%s]，可选 ip、colo", *by)
+	}
+
+	since := time.Now().AddDate(0, 0, -*days)
+	all, err := history.Store{Dir: *dir}.Load(since)
+	if err != nil {
+		log.Fatalf("[错误] %v", err)
+	}
+	if len(all) == 0 {
+		fmt.Printf("[信息] 历史记录目录 [%s] 中最近 %d 天没有测速记录。\n", *dir, *days)
+		return
+	}
+	trends := history.Trends(all, *runs, *by)
+	if *only != "" {
+		var filtered []history.Trend
+		for _, t := range trends {
+			if t.Key == *only {
+				filtered = append(filtered, t)
+			}
+		}
+		trends = filtered
+	}
+	if *num > 0 && len(trends) > *num {
+		trends = trends[:*num]
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(trends); err != nil {
+			log.Fatalf("[错误] %v", err)
+		}
+		return
+	}
+	counted := len(all)
+	if *runs > 0 && counted > *runs {
+		counted = *runs
+	}
+	fmt.Printf("最近 %d 次测速（%s ~ %s）\n", counted, all[len(all)-counted].Time.Format("2006-01-02 15:04"), all[len(all)-1].Time.Format("2006-01-02 15:04"))
+	key, keyWidth := "IP 地址", 18
+	if *by == history.ByColo {
+		key, keyWidth = "数据中心", 10
+	}
+	for _, t := range trends {
+		if len(t.Key) > 15 { // IPv6
+			keyWidth = 42
+			break
+		}
+	}
+	widths := []int{keyWidth, 10, 6, 6, 8, 10, 17, 10, 0}
+	withColo := *by == history.ByIP // 按数据中心分组时不再显示数据中心列
+	printRow(widths, withColo, key, "数据中心", "出现", "满足", "稳定性", "中位延迟", "中位速度 (MB/s)", "速度波动", "最近满足时间")
+	for _, t := range trends {
+		lastGood := "-"
+		if t.LastSeenGood != nil {
+			lastGood = t.LastSeenGood.Format("2006-01-02 15:04")
+		}
+		printRow(widths, withColo, t.Key, t.Colo, strconv.Itoa(t.Seen), strconv.Itoa(t.Good), fmt.Sprintf("%.0f%%", t.Stability*100),
+			fmt.Sprintf("%.2f", t.MedianDelay), fmt.Sprintf("%.2f", t.MedianSpeed), fmt.Sprintf("%.0f%%", t.SpeedCV*100), lastGood)
+	}
+}
+
+// 按显示宽度（中文占两格）左对齐输出一行，第二列为数据中心
+func printRow(widths []int, withColo bool, columns ...string) {
+	var line strings.Builder
+	for i, column := range columns {
+		if i == 1 && !withColo {
+			continue
+		}
+		line.WriteString(column)
+		width := 0
+		for _, r := range column {
+			if r >= 0x2E80 {
+				width += 2
+			} else {
+				width++
+			}
+		}
+		for ; width < widths[i]; width++ {
+			line.WriteByte(' ')
+		}
+	}
+	fmt.Println(line.String())
+}
@@ -3,63 +3,104 @@ package utils
 import (
 	"encoding/csv"
 	"fmt"
-	"log"
 	"math/rand"
 	"net"
 	"os"
 	"sort"
 	"strconv"
 	"time"
-	"sync/atomic"
+
+	"github.com/GuangYu-yu/CloudflareSpeedTest/colo"
 )
 
 const (
-	defaultOutput         = "result.csv"
-	maxDelay              = 9999 * time.Millisecond
-	minDelay              = 0 * time.Millisecond
-	maxLossRate   float32 = 1.0
+	defaultOutput           = "result.csv"
+	maxDelay                = 9999 * time.Millisecond
+	minDelay                = 0 * time.Millisecond
+	maxLossRate     float32 = 1.0
+	defaultPrintNum         = 10
 )
 
-var (
-	InputMaxDelay    = maxDelay
-	InputMinDelay    = minDelay
-	InputMaxLossRate = maxLossRate
-	Output           = defaultOutput
-	PrintNum         = 10
-	currentBandwidth int64
-)
+// 延迟测速结果的过滤条件，应以 DefaultFilter 的返回值为基础修改
+type Filter struct {
+	MaxDelay    time.Duration // 平均延迟上限
+	MinDelay    time.Duration // 平均延迟下限
+	MaxLossRate float32       // 丢包几率上限，0 表示过滤掉任何丢包的 IP
+
+	// 延迟分布条件（最大延迟、中位延迟、P95 延迟、抖动），默认值 9999 ms 即不过滤
+	MaxPeakDelay   time.Duration
+	MaxMedianDelay time.Duration
+	MaxP95Delay    time.Duration
+	MaxJitter      time.Duration
+
+	// 各阶段平均耗时条件（连接、TLS 握手、首字节），未记录该阶段的 IP 不受限制
+	MaxConnectDelay time.Duration
+	MaxTLSDelay     time.Duration
+	MaxTTFB         time.Duration
+}
+
+// 默认的过滤条件，即不过滤
+func DefaultFilter() Filter {
+	return Filter{
+		MaxDelay:       maxDelay,
+		MinDelay:       minDelay,
+		MaxLossRate:    maxLossRate,
+		MaxPeakDelay:   maxDelay,
+		MaxMedianDelay: maxDelay,
+		MaxP95Delay:    maxDelay,
+		MaxJitter:      maxDelay,
+
+		MaxConnectDelay: maxDelay,
+		MaxTLSDelay:     maxDelay,
+		MaxTTFB:         maxDelay,
+	}
+}
 
-// 带宽相关函数
-func GetCurrentBandwidth() float64 {
-	return float64(atomic.LoadInt64(&currentBandwidth)) / 1024 / 1024
+// 结果输出配置
+type OutputOptions struct {
+	File     string // 结果文件路径，为空时不写入文件
+	Format   string // 结果文件格式 (csv/json/jsonl)，为空时根据文件扩展名判断
+	PrintNum int    // 显示结果数量，为 0 时不显示结果
 }
 
-func UpdateBandwidth(speed int64) {
-	atomic.StoreInt64(&currentBandwidth, speed)
+// 默认的结果输出配置
+func DefaultOutputOptions() OutputOptions {
+	return OutputOptions{File: defaultOutput, PrintNum: defaultPrintNum}
 }
 
 // 是否打印测试结果
-func NoPrintResult() bool {
-	return PrintNum == 0
+func (o OutputOptions) NoPrintResult() bool {
+	return o.PrintNum == 0
 }
 
 // 是否输出到文件
-func noOutput() bool {
-	return Output == "" || Output == " "
+func (o OutputOptions) noOutput() bool {
+	return o.File == "" || o.File == " "
 }
 
 type PingData struct {
-	IP       *net.IPAddr
-	Sended   int
-	Received int
-	Delay    time.Duration
+	IP          *net.IPAddr
+	Sended      int
+	Received    int
+	Delay       time.Duration
+	MinDelay    time.Duration
+	MaxDelay    time.Duration
+	MedianDelay time.Duration
+	P95Delay    time.Duration
+	Jitter      time.Duration
+	Phases      DelayPhases // 各阶段的平均耗时，仅部分延迟测速模式下记录
 }
 
 type CloudflareIPData struct {
 	*PingData
 	lossRate      float32
 	DownloadSpeed float64
-	datacenter    string
+	MultiSpeed    float64 // 多连接同时下载的总速度，未测速时为 0
+	UploadSpeed   float64 // 上传速度，未测速时为 0
+	Score         float64 // 综合评分，见 Scorer
+	scored        bool
+	Datacenter    string
+	Trace         TraceInfo // 测速完成后通过 /cdn-cgi/trace 获取的信息
 }
 
 // 计算丢包率
@@ -71,39 +112,141 @@ func (cf *CloudflareIPData) getLossRate() float32 {
 	return cf.lossRate
 }
 
-func (cf *CloudflareIPData) toString() []string {
-	result := make([]string, 7)
+// 结果文件中按需追加的列，只有存在对应数据时才输出
+type extraColumns struct {
+	multiSpeed  bool
+	uploadSpeed bool
+	phases      bool
+	trace       bool
+	score       bool
+}
+
+func newExtraColumns(data []CloudflareIPData) extraColumns {
+	return extraColumns{multiSpeed: hasMultiSpeed(data), uploadSpeed: hasUploadSpeed(data), phases: hasPhases(data), trace: hasTrace(data), score: len(data) > 0 && data[0].scored}
+}
+
+func (c extraColumns) head() []string {
+	var head []string
+	if c.multiSpeed {
+		head = append(head, "多连接速度 (MB/s)")
+	}
+	if c.uploadSpeed {
+		head = append(head, "上传速度 (MB/s)")
+	}
+	if c.phases {
+		head = append(head, "连接耗时", "TLS 握手耗时", "首字节耗时")
+	}
+	if c.trace {
+		head = append(head, "Trace 数据中心", "客户端 IP", "HTTP 版本", "TLS 版本", "WARP")
+	}
+	if c.score {
+		head = append(head, "综合评分")
+	}
+	return head
+}
+
+func (cf *CloudflareIPData) toString(extra extraColumns) []string {
+	result := make([]string, 13, 24)
 	result[0] = cf.IP.String()
 	result[1] = strconv.Itoa(cf.Sended)
 	result[2] = strconv.Itoa(cf.Received)
 	result[3] = strconv.FormatFloat(float64(cf.getLossRate()), 'f', 2, 32)
-	result[4] = strconv.FormatFloat(cf.Delay.Seconds()*1000, 'f', 2, 32)
-	result[5] = strconv.FormatFloat(cf.DownloadSpeed/1024/1024, 'f', 2, 32)
-	result[6] = cf.datacenter
+	result[4] = formatDelay(cf.Delay)
+	result[5] = formatDelay(cf.MinDelay)
+	result[6] = formatDelay(cf.MaxDelay)
+	result[7] = formatDelay(cf.MedianDelay)
+	result[8] = formatDelay(cf.P95Delay)
+	result[9] = formatDelay(cf.Jitter)
+	result[10] = strconv.FormatFloat(cf.DownloadSpeed/1024/1024, 'f', 2, 32)
+	result[11] = cf.Datacenter
+	result[12] = cf.Location()
+	if extra.multiSpeed {
+		result = append(result, strconv.FormatFloat(cf.MultiSpeed/1024/1024, 'f', 2, 32))
+	}
+	if extra.uploadSpeed {
+		result = append(result, strconv.FormatFloat(cf.UploadSpeed/1024/1024, 'f', 2, 32))
+	}
+	if extra.phases {
+		result = append(result, formatDelay(cf.Phases.Connect), formatDelay(cf.Phases.TLS), formatDelay(cf.Phases.TTFB))
+	}
+	if extra.trace {
+		result = append(result, cf.Trace.Colo, cf.Trace.ClientIP, cf.Trace.HTTPVersion, cf.Trace.TLSVersion, cf.Trace.Warp)
+	}
+	if extra.score {
+		result = append(result, strconv.FormatFloat(cf.Score, 'f', 4, 64))
+	}
 	return result
 }
 
-func ExportCsv(data []CloudflareIPData) {
-	if noOutput() || len(data) == 0 {
-		return
+// 数据中心所在的城市及国家，未知时为空
+func (cf *CloudflareIPData) Location() string {
+	if l, ok := colo.Lookup(cf.Datacenter); ok {
+		return l.String()
+	}
+	return ""
+}
+
+// 是否有 IP 进行了多连接下载测速
+func hasMultiSpeed(data []CloudflareIPData) bool {
+	for _, v := range data {
+		if v.MultiSpeed > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否有 IP 进行了上传测速
+func hasUploadSpeed(data []CloudflareIPData) bool {
+	for _, v := range data {
+		if v.UploadSpeed > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否有 IP 记录了各阶段耗时，有则在结果文件中追加对应的列
+func hasPhases(data []CloudflareIPData) bool {
+	for _, v := range data {
+		if v.Phases != (DelayPhases{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// 延迟转为毫秒字符串
+func formatDelay(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds()*1000, 'f', 2, 32)
+}
+
+func (o OutputOptions) ExportCsv(data []CloudflareIPData) error {
+	if o.noOutput() || len(data) == 0 {
+		return nil
 	}
-	
-	fp, err := os.Create(Output)
+
+	fp, err := os.Create(o.File)
 	if err != nil {
-		log.Fatalf("创建文件[%s]失败：%v", Output, err)
-		return
+		return fmt.Errorf("创建文件[%s]失败：%v", o.File, err)
 	}
 	defer fp.Close()
 	w := csv.NewWriter(fp)
-	_ = w.Write([]string{"IP 地址", "已发送", "已接收", "丢包率", "平均延迟", "下载速度 (MB/s)", "数据中心"})
-	_ = w.WriteAll(convertToString(data))
+	extra := newExtraColumns(data)
+	head := []string{"IP 地址", "已发送", "已接收", "丢包率", "平均延迟", "最小延迟", "最大延迟", "中位延迟", "P95 延迟", "抖动", "下载速度 (MB/s)", "数据中心", "位置"}
+	_ = w.Write(append(head, extra.head()...))
+	_ = w.WriteAll(convertToString(data, extra))
 	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("写入文件[%s]失败：%v", o.File, err)
+	}
+	return nil
 }
 
-func convertToString(data []CloudflareIPData) [][]string {
+func convertToString(data []CloudflareIPData, extra extraColumns) [][]string {
 	result := make([][]string, 0)
 	for _, v := range data {
-		result = append(result, v.toString())
+		result = append(result, v.toString(extra))
 	}
 	return result
 }
@@ -168,18 +311,18 @@ func (s PingDelaySet) GroupAndShuffle() PingDelaySet {
 }
 
 // 延迟条件过滤
-func (s PingDelaySet) FilterDelay() (data PingDelaySet) {
-	if InputMaxDelay > maxDelay || InputMinDelay < minDelay { // 当输入的延迟条件不在默认范围内时，不进行过滤
+func (s PingDelaySet) FilterDelay(f Filter) (data PingDelaySet) {
+	if f.MaxDelay > maxDelay || f.MinDelay < minDelay { // 当输入的延迟条件不在默认范围内时，不进行过滤
 		return s.GroupAndShuffle()
 	}
-	if InputMaxDelay == maxDelay && InputMinDelay == minDelay { // 当输入的延迟条件为默认值时，不进行过滤
+	if f.MaxDelay == maxDelay && f.MinDelay == minDelay { // 当输入的延迟条件为默认值时，不进行过滤
 		return s.GroupAndShuffle()
 	}
 	for _, v := range s {
-		if v.Delay > InputMaxDelay { // 平均延迟上限，延迟大于条件最大值时，后面的数据都不满足条件，直接跳出循环
+		if v.Delay > f.MaxDelay { // 平均延迟上限，延迟大于条件最大值时，后面的数据都不满足条件，直接跳出循环
 			break
 		}
-		if v.Delay < InputMinDelay { // 平均延迟下限，延迟小于条件最小值时，不满足条件，跳过
+		if v.Delay < f.MinDelay { // 平均延迟下限，延迟小于条件最小值时，不满足条件，跳过
 			continue
 		}
 		data = append(data, v) // 延迟满足条件时，添加到新数组中
@@ -188,12 +331,12 @@ func (s PingDelaySet) FilterDelay() (data PingDelaySet) {
 }
 
 // 丢包条件过滤
-func (s PingDelaySet) FilterLossRate() (data PingDelaySet) {
-	if InputMaxLossRate >= maxLossRate { // 当输入的丢包条件为默认值时，不进行过滤
+func (s PingDelaySet) FilterLossRate(f Filter) (data PingDelaySet) {
+	if f.MaxLossRate >= maxLossRate { // 当输入的丢包条件为默认值时，不进行过滤
 		return s
 	}
 	for _, v := range s {
-		if v.getLossRate() > InputMaxLossRate { // 丢包几率上限
+		if v.getLossRate() > f.MaxLossRate { // 丢包几率上限
 			break
 		}
 		data = append(data, v) // 丢包率满足条件时，添加到新数组中
@@ -201,6 +344,26 @@ func (s PingDelaySet) FilterLossRate() (data PingDelaySet) {
 	return
 }
 
+// 延迟分布及各阶段耗时条件过滤
+func (s PingDelaySet) FilterDelayStats(f Filter) (data PingDelaySet) {
+	if f.MaxPeakDelay >= maxDelay && f.MaxMedianDelay >= maxDelay &&
+		f.MaxP95Delay >= maxDelay && f.MaxJitter >= maxDelay &&
+		f.MaxConnectDelay >= maxDelay && f.MaxTLSDelay >= maxDelay && f.MaxTTFB >= maxDelay { // 当输入的条件均为默认值时，不进行过滤
+		return s
+	}
+	for _, v := range s {
+		if v.MaxDelay > f.MaxPeakDelay || v.MedianDelay > f.MaxMedianDelay ||
+			v.P95Delay > f.MaxP95Delay || v.Jitter > f.MaxJitter { // 任一条件不满足时跳过（分组随机后已不再按这些条件有序）
+			continue
+		}
+		if v.Phases.Connect > f.MaxConnectDelay || v.Phases.TLS > f.MaxTLSDelay || v.Phases.TTFB > f.MaxTTFB {
+			continue
+		}
+		data = append(data, v)
+	}
+	return
+}
+
 func (s PingDelaySet) Len() int {
 	return len(s)
 }
@@ -228,33 +391,50 @@ func (s DownloadSpeedSet) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
-func (s DownloadSpeedSet) Print() {
-	if NoPrintResult() {
+func (s DownloadSpeedSet) Print(o OutputOptions) {
+	if o.NoPrintResult() {
 		return
 	}
 	if len(s) <= 0 { // IP数组长度(IP数量) 大于 0 时继续
 		fmt.Println("\n[信息] 完整测速结果 IP 数量为 0，跳过输出结果。")
 		return
 	}
-	dateString := convertToString(s) // 转为多维数组 [][]String
-	if len(dateString) < PrintNum {  // 如果IP数组长度(IP数量) 小于  打印次数，则次数改为IP数量
-		PrintNum = len(dateString)
+	// 终端中只追加测速了才有的速度列，其余按需追加的列只写入结果文件
+	extra := extraColumns{multiSpeed: hasMultiSpeed(s), uploadSpeed: hasUploadSpeed(s)}
+	dateString := convertToString(s, extra) // 转为多维数组 [][]String
+	printNum := o.PrintNum
+	if len(dateString) < printNum { // 如果IP数组长度(IP数量) 小于  打印次数，则次数改为IP数量
+		printNum = len(dateString)
 	}
-	headFormat := "%-16s%-5s%-5s%-5s%-6s%-11s%-5s\n"
-	dataFormat := "%-18s%-8s%-8s%-8s%-10s%-15s%-8s\n"
-	for i := 0; i < PrintNum; i++ {
+	headFormat := "%-16s%-5s%-5s%-5s%-6s%-6s%-6s%-6s%-8s%-8s%-11s%-6s"
+	dataFormat := "%-18s%-8s%-8s%-8s%-10s%-10s%-10s%-10s%-10s%-10s%-15s%-10s"
+	for i := 0; i < printNum; i++ {
 		if len(dateString[i][0]) > 15 {
-			headFormat = "%-40s%-5s%-5s%-5s%-6s%-11s%-5s\n"
-			dataFormat = "%-42s%-8s%-8s%-8s%-10s%-15s%-8s\n"
+			headFormat = "%-40s%-5s%-5s%-5s%-6s%-6s%-6s%-6s%-8s%-8s%-11s%-6s"
+			dataFormat = "%-42s%-8s%-8s%-8s%-10s%-10s%-10s%-10s%-10s%-10s%-15s%-10s"
 			break
 		}
 	}
-	fmt.Printf(headFormat, "IP 地址", "已发送", "已接收", "丢包率", "平均延迟", "下载速度 (MB/s)", "数据中心")
-	for i := 0; i < PrintNum; i++ {
-		fmt.Printf(dataFormat, dateString[i][0], dateString[i][1], dateString[i][2], dateString[i][3], 
-			dateString[i][4], dateString[i][5], dateString[i][6])
+	head := []interface{}{"IP 地址", "已发送", "已接收", "丢包率", "平均延迟", "最小延迟", "最大延迟", "中位延迟", "P95 延迟", "抖动", "下载速度 (MB/s)", "数据中心"}
+	if extra.multiSpeed {
+		head = append(head, "多连接速度 (MB/s)")
+		headFormat, dataFormat = headFormat+"%-13s", dataFormat+"%-18s"
+	}
+	if extra.uploadSpeed {
+		head = append(head, "上传速度 (MB/s)")
+		headFormat, dataFormat = headFormat+"%-12s", dataFormat+"%-16s"
+	}
+	fmt.Printf(headFormat+"\n", head...)
+	for i := 0; i < printNum; i++ {
+		row := make([]interface{}, 0, len(head))
+		for j, v := range dateString[i] {
+			if j != 12 { // 不显示城市及国家
+				row = append(row, v)
+			}
+		}
+		fmt.Printf(dataFormat+"\n", row...)
 	}
-	if !noOutput() {
-		fmt.Printf("\n完整测速结果已写入 %v 文件，可使用记事本/表格软件查看。\n", Output)
+	if !o.noOutput() {
+		fmt.Printf("\n完整测速结果已写入 %v 文件，可使用记事本/表格软件查看。\n", o.File)
 	}
 }
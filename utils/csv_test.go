@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 捕获 Print 输出到终端的内容
+func capturePrint(t *testing.T, s DownloadSpeedSet) []string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	s.Print(OutputOptions{PrintNum: 10})
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return strings.Split(strings.TrimSpace(string(out)), "\n")
+}
+
+// 终端中只有测速了多连接速度、上传速度时才追加对应的列
+func TestPrintExtraColumns(t *testing.T) {
+	tests := []struct {
+		name          string
+		multi, upload float64 // MB/s
+		head, row     []string
+	}{
+		{"无", 0, 0, nil, nil},
+		{"多连接速度", 30, 0, []string{"多连接速度 (MB/s)"}, []string{"30.00"}},
+		{"上传速度", 0, 5, []string{"上传速度 (MB/s)"}, []string{"5.00"}},
+		{"全部", 30, 5, []string{"多连接速度 (MB/s)", "上传速度 (MB/s)"}, []string{"30.00", "5.00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := DownloadSpeedSet{{
+				PingData:      &PingData{IP: &net.IPAddr{IP: net.ParseIP("1.1.1.1")}, Sended: 4, Received: 4},
+				DownloadSpeed: 10 * 1024 * 1024,
+				MultiSpeed:    tt.multi * 1024 * 1024,
+				UploadSpeed:   tt.upload * 1024 * 1024,
+				Datacenter:    "NRT",
+			}}
+			lines := capturePrint(t, data)
+			if len(lines) != 2 {
+				t.Fatalf("输出 = %q，应为表头及一行结果", lines)
+			}
+			if !strings.HasSuffix(strings.Join(strings.Fields(lines[0]), " "), strings.Join(append([]string{"数据中心"}, tt.head...), " ")) {
+				t.Errorf("表头 = %s，应在数据中心之后追加 %v", lines[0], tt.head)
+			}
+			row := strings.Fields(lines[1])
+			if got := strings.Join(row[11:], " "); got != strings.Join(append([]string{"NRT"}, tt.row...), " ") {
+				t.Errorf("数据中心及追加的列 = %s，应为 NRT %v", got, tt.row)
+			}
+			if strings.Contains(lines[1], "Tokyo") {
+				t.Error("终端中不应显示城市及国家")
+			}
+		})
+	}
+}
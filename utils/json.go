@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+)
+
+// 本次测速的运行信息，写入 JSON/JSONL 结果文件
+type RunInfo struct {
+	Version   string            `json:"version"`
+	Mode      string            `json:"mode"`
+	StartTime time.Time         `json:"start_time"`
+	EndTime   time.Time         `json:"end_time"`
+	Params    map[string]string `json:"params"`
+}
+
+// 单个 IP 的测速结果，字段名保持稳定以便其他程序解析（延迟单位 ms，速度单位 MB/s）
+type IPRecord struct {
+	IP            string       `json:"ip"`
+	Sent          int          `json:"sent"`
+	Received      int          `json:"received"`
+	LossRate      float64      `json:"loss_rate"`
+	Delay         float64      `json:"delay_ms"`
+	MinDelay      float64      `json:"min_delay_ms"`
+	MaxDelay      float64      `json:"max_delay_ms"`
+	MedianDelay   float64      `json:"median_delay_ms"`
+	P95Delay      float64      `json:"p95_delay_ms"`
+	Jitter        float64      `json:"jitter_ms"`
+	ConnectDelay  float64      `json:"connect_ms,omitempty"`
+	TLSDelay      float64      `json:"tls_ms,omitempty"`
+	TTFB          float64      `json:"ttfb_ms,omitempty"`
+	DownloadSpeed float64      `json:"download_speed_mb_s"`
+	MultiSpeed    float64      `json:"multi_download_speed_mb_s,omitempty"` // 多连接同时下载的总速度
+	UploadSpeed   float64      `json:"upload_speed_mb_s,omitempty"`
+	Score         *float64     `json:"score,omitempty"` // 综合评分，未评分时不输出
+	Colo          string       `json:"colo"`
+	Location      string       `json:"location,omitempty"` // 数据中心所在的城市及国家，如 Tokyo, JP
+	Trace         *TraceRecord `json:"trace,omitempty"`
+}
+
+// /cdn-cgi/trace 获取的信息，未获取时不输出
+type TraceRecord struct {
+	Colo     string `json:"colo"`
+	ClientIP string `json:"client_ip"`
+	HTTP     string `json:"http"`
+	TLS      string `json:"tls"`
+	Warp     string `json:"warp"`
+}
+
+func (cf *CloudflareIPData) ToRecord() *IPRecord {
+	record := &IPRecord{
+		IP:            cf.IP.String(),
+		Sent:          cf.Sended,
+		Received:      cf.Received,
+		LossRate:      float64(cf.getLossRate()),
+		Delay:         durationToMs(cf.Delay),
+		MinDelay:      durationToMs(cf.MinDelay),
+		MaxDelay:      durationToMs(cf.MaxDelay),
+		MedianDelay:   durationToMs(cf.MedianDelay),
+		P95Delay:      durationToMs(cf.P95Delay),
+		Jitter:        durationToMs(cf.Jitter),
+		ConnectDelay:  durationToMs(cf.Phases.Connect),
+		TLSDelay:      durationToMs(cf.Phases.TLS),
+		TTFB:          durationToMs(cf.Phases.TTFB),
+		DownloadSpeed: cf.DownloadSpeed / 1024 / 1024,
+		MultiSpeed:    cf.MultiSpeed / 1024 / 1024,
+		UploadSpeed:   cf.UploadSpeed / 1024 / 1024,
+		Colo:          cf.Datacenter,
+		Location:      cf.Location(),
+	}
+	if cf.scored && !math.IsInf(cf.Score, 0) { // JSON 不支持无穷大
+		score := cf.Score
+		record.Score = &score
+	}
+	if cf.Trace != (TraceInfo{}) {
+		record.Trace = &TraceRecord{
+			Colo:     cf.Trace.Colo,
+			ClientIP: cf.Trace.ClientIP,
+			HTTP:     cf.Trace.HTTPVersion,
+			TLS:      cf.Trace.TLSVersion,
+			Warp:     cf.Trace.Warp,
+		}
+	}
+	return record
+}
+
+func durationToMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// 检查指定的结果文件格式是否有效
+func (o OutputOptions) Check() error {
+	switch strings.ToLower(o.Format) {
+	case "", FormatCSV, FormatJSON, FormatJSONL:
+		return nil
+	}
+	return fmt.Errorf("不支持的结果文件格式 [%s]，可选 %s、%s、%s", o.Format, FormatCSV, FormatJSON, FormatJSONL)
+}
+
+// 获取实际的输出格式
+func (o OutputOptions) format() string {
+	if o.Format != "" {
+		return strings.ToLower(o.Format)
+	}
+	switch strings.ToLower(filepath.Ext(o.File)) {
+	case ".json":
+		return FormatJSON
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	}
+	return FormatCSV
+}
+
+// 按输出格式写入结果文件
+func (o OutputOptions) Export(data []CloudflareIPData, info *RunInfo) error {
+	switch o.format() {
+	case FormatJSON:
+		return o.exportJSON(data, info, false)
+	case FormatJSONL:
+		return o.exportJSON(data, info, true)
+	default:
+		return o.ExportCsv(data)
+	}
+}
+
+func (o OutputOptions) exportJSON(data []CloudflareIPData, info *RunInfo, lines bool) error {
+	if o.noOutput() || len(data) == 0 {
+		return nil
+	}
+
+	fp, err := os.Create(o.File)
+	if err != nil {
+		return fmt.Errorf("创建文件[%s]失败：%v", o.File, err)
+	}
+	defer fp.Close()
+	if lines {
+		err = writeJSONL(fp, data, info)
+	} else {
+		err = writeJSON(fp, data, info)
+	}
+	if err != nil {
+		return fmt.Errorf("写入文件[%s]失败：%v", o.File, err)
+	}
+	return nil
+}
+
+// JSON：一个对象，meta 为运行信息，results 为测速结果
+func writeJSON(w io.Writer, data []CloudflareIPData, info *RunInfo) error {
+	results := make([]*IPRecord, 0, len(data))
+	for i := range data {
+		results = append(results, data[i].ToRecord())
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Meta    *RunInfo    `json:"meta"`
+		Results []*IPRecord `json:"results"`
+	}{info, results})
+}
+
+// JSONL：每行一个对象，首行为运行信息 (type=meta)，其后每行一个测速结果 (type=result)
+func writeJSONL(w io.Writer, data []CloudflareIPData, info *RunInfo) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(struct {
+		Type string `json:"type"`
+		*RunInfo
+	}{"meta", info}); err != nil {
+		return err
+	}
+	for i := range data {
+		if err := enc.Encode(struct {
+			Type string `json:"type"`
+			*IPRecord
+		}{"result", data[i].ToRecord()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+var testRunInfo = &RunInfo{
+	Version:   "v2.3.0",
+	Mode:      "httping",
+	StartTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	EndTime:   time.Date(2024, 1, 2, 3, 5, 5, 0, time.UTC),
+	Params:    map[string]string{"n": "200"},
+}
+
+// 第一个 IP 只有基本的测速结果，第二个 IP 各项均有数据，第三个 IP 全部丢包
+func testExportData() []CloudflareIPData {
+	full := CloudflareIPData{
+		PingData: &PingData{
+			IP: &net.IPAddr{IP: net.ParseIP("2606:4700::1")}, Sended: 4,
+			Phases: DelayPhases{Connect: 10 * time.Millisecond, TLS: 20 * time.Millisecond, TTFB: 30 * time.Millisecond},
+		},
+		DownloadSpeed: 10 * 1024 * 1024,
+		MultiSpeed:    30 * 1024 * 1024,
+		UploadSpeed:   5 * 1024 * 1024,
+		Score:         1.5,
+		scored:        true,
+		Datacenter:    "NRT",
+		Trace:         TraceInfo{Colo: "NRT", ClientIP: "203.0.113.1", HTTPVersion: "http/2", TLSVersion: "TLSv1.3", Warp: "off"},
+	}
+	full.SetDelays(ms(40, 60))
+	basic := CloudflareIPData{PingData: &PingData{IP: &net.IPAddr{IP: net.ParseIP("1.1.1.1")}, Sended: 4}, DownloadSpeed: 1024 * 1024}
+	basic.SetDelays(ms(50, 50, 50, 50))
+	lost := CloudflareIPData{PingData: &PingData{IP: &net.IPAddr{IP: net.ParseIP("1.0.0.1")}, Sended: 4}}
+	lost.SetDelays(nil)
+	return []CloudflareIPData{basic, full, lost}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	testMetaKeys   = []string{"end_time", "mode", "params", "start_time", "version"}
+	testBasicKeys  = []string{"colo", "delay_ms", "download_speed_mb_s", "ip", "jitter_ms", "loss_rate", "max_delay_ms", "median_delay_ms", "min_delay_ms", "p95_delay_ms", "received", "sent"}
+	testFullKeys   = []string{"colo", "connect_ms", "delay_ms", "download_speed_mb_s", "ip", "jitter_ms", "location", "loss_rate", "max_delay_ms", "median_delay_ms", "min_delay_ms", "multi_download_speed_mb_s", "p95_delay_ms", "received", "score", "sent", "tls_ms", "trace", "ttfb_ms", "upload_speed_mb_s"}
+	testTraceKeys  = []string{"client_ip", "colo", "http", "tls", "warp"}
+	testResultKeys = [][]string{testBasicKeys, testFullKeys, testBasicKeys}
+)
+
+// 检查单个测速结果的字段，未测速的可选字段不输出
+func checkRecord(t *testing.T, i int, record map[string]interface{}) {
+	t.Helper()
+	delete(record, "type") // JSONL 中的类型
+	if keys := sortedKeys(record); !reflect.DeepEqual(keys, testResultKeys[i]) {
+		t.Errorf("第 %d 个结果的字段 = %v\n应为 %v", i+1, keys, testResultKeys[i])
+	}
+	want := map[int]map[string]interface{}{
+		0: {"ip": "1.1.1.1", "sent": 4.0, "received": 4.0, "loss_rate": 0.0, "delay_ms": 50.0, "download_speed_mb_s": 1.0, "colo": ""},
+		1: {"ip": "2606:4700::1", "delay_ms": 50.0, "p95_delay_ms": 60.0, "jitter_ms": 20.0, "connect_ms": 10.0, "multi_download_speed_mb_s": 30.0,
+			"upload_speed_mb_s": 5.0, "score": 1.5, "location": "Tokyo, JP"},
+		2: {"ip": "1.0.0.1", "sent": 4.0, "received": 0.0, "loss_rate": 1.0, "delay_ms": 0.0},
+	}[i]
+	for k, v := range want {
+		if record[k] != v {
+			t.Errorf("第 %d 个结果的 %s = %v，应为 %v", i+1, k, record[k], v)
+		}
+	}
+	if trace, ok := record["trace"].(map[string]interface{}); ok {
+		if keys := sortedKeys(trace); !reflect.DeepEqual(keys, testTraceKeys) || trace["client_ip"] != "203.0.113.1" {
+			t.Errorf("trace = %v", trace)
+		}
+	}
+}
+
+func checkMeta(t *testing.T, meta map[string]interface{}) {
+	t.Helper()
+	delete(meta, "type")
+	if keys := sortedKeys(meta); !reflect.DeepEqual(keys, testMetaKeys) {
+		t.Errorf("运行信息的字段 = %v，应为 %v", keys, testMetaKeys)
+	}
+	if meta["mode"] != "httping" || meta["start_time"] != "2024-01-02T03:04:05Z" {
+		t.Errorf("运行信息 = %v", meta)
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	o := OutputOptions{File: filepath.Join(t.TempDir(), "result.json")}
+	if err := o.Export(testExportData(), testRunInfo); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(o.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(content, &out); err != nil {
+		t.Fatal(err)
+	}
+	if keys := sortedKeys(out); !reflect.DeepEqual(keys, []string{"meta", "results"}) {
+		t.Fatalf("顶层字段 = %v，应为 meta、results", keys)
+	}
+	checkMeta(t, out["meta"].(map[string]interface{}))
+	results := out["results"].([]interface{})
+	if len(results) != 3 {
+		t.Fatalf("结果数量 = %d，应为 3", len(results))
+	}
+	for i, r := range results {
+		checkRecord(t, i, r.(map[string]interface{}))
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	for _, o := range []OutputOptions{
+		{File: filepath.Join(t.TempDir(), "result.jsonl")},
+		{File: filepath.Join(t.TempDir(), "result.ndjson")},
+		{File: filepath.Join(t.TempDir(), "result.txt"), Format: "JSONL"},
+	} {
+		t.Run(filepath.Base(o.File), func(t *testing.T) {
+			if err := o.Export(testExportData(), testRunInfo); err != nil {
+				t.Fatal(err)
+			}
+			fp, err := os.Open(o.File)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fp.Close()
+			var lines []map[string]interface{}
+			scanner := bufio.NewScanner(fp)
+			for scanner.Scan() {
+				var line map[string]interface{}
+				if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+					t.Fatalf("第 %d 行不是 JSON：%v", len(lines)+1, err)
+				}
+				lines = append(lines, line)
+			}
+			if len(lines) != 4 {
+				t.Fatalf("行数 = %d，应为 4（运行信息 + 3 个结果）", len(lines))
+			}
+			if lines[0]["type"] != "meta" {
+				t.Errorf("首行的类型 = %v，应为 meta", lines[0]["type"])
+			}
+			checkMeta(t, lines[0])
+			for i, line := range lines[1:] {
+				if line["type"] != "result" {
+					t.Errorf("第 %d 行的类型 = %v，应为 result", i+2, line["type"])
+				}
+				checkRecord(t, i, line)
+			}
+		})
+	}
+}
+
+// 没有测速结果或未指定结果文件时不写入
+func TestExportJSONEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.json")
+	if err := (OutputOptions{File: path}).Export(nil, testRunInfo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("没有测速结果时不应创建文件：%v", err)
+	}
+	if err := (OutputOptions{File: " ", Format: FormatJSON}).Export(testExportData(), testRunInfo); err != nil {
+		t.Errorf("未指定结果文件时不应出错：%v", err)
+	}
+}
@@ -2,13 +2,16 @@ package utils
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/cheggaaa/pb/v3"
 )
 
+// 进度条，为 nil 时不显示（各方法均可在 nil 上调用）
 type Bar struct {
-	pb *pb.ProgressBar
+	pb         *pb.ProgressBar
 	isDownload bool
+	bandwidth  int64 // 当前下载速度 (B/s)，仅用于显示
 }
 
 func NewBar(count int, MyStrStart, MyStrEnd string) *Bar {
@@ -27,10 +30,21 @@ func NewBar(count int, MyStrStart, MyStrEnd string) *Bar {
 	return &Bar{pb: bar, isDownload: isDownload}
 }
 
+// 更新下载测速进度条显示的带宽
+func (b *Bar) SetBandwidth(speed int64) {
+	if b == nil {
+		return
+	}
+	atomic.StoreInt64(&b.bandwidth, speed)
+}
+
 func (b *Bar) Grow(num int, val string) {
+	if b == nil {
+		return
+	}
 	if b.isDownload {
 		// 下载测速时显示带宽
-		bandwidth := fmt.Sprintf("%.2f MB/s", GetCurrentBandwidth())
+		bandwidth := fmt.Sprintf("%.2f MB/s", float64(atomic.LoadInt64(&b.bandwidth))/1024/1024)
 		b.pb.Set("Bandwidth", bandwidth).Add(num)
 	} else {
 		// 延迟测速时显示可用数量
@@ -39,5 +53,8 @@ func (b *Bar) Grow(num int, val string) {
 }
 
 func (b *Bar) Done() {
+	if b == nil {
+		return
+	}
 	b.pb.Finish()
 }
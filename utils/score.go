@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 可用于评分的测速指标，延迟单位 ms，速度单位 MB/s，丢包率为 0~1
+type scoreMetric struct {
+	value        func(cf *CloudflareIPData) float64
+	higherBetter bool // 权重模式下数值越高越好（速度），否则越低越好（延迟、丢包）
+}
+
+var scoreMetrics = map[string]scoreMetric{
+	"delay":          {func(cf *CloudflareIPData) float64 { return durationToMs(cf.Delay) }, false},
+	"min_delay":      {func(cf *CloudflareIPData) float64 { return durationToMs(cf.MinDelay) }, false},
+	"max_delay":      {func(cf *CloudflareIPData) float64 { return durationToMs(cf.MaxDelay) }, false},
+	"median_delay":   {func(cf *CloudflareIPData) float64 { return durationToMs(cf.MedianDelay) }, false},
+	"p95_delay":      {func(cf *CloudflareIPData) float64 { return durationToMs(cf.P95Delay) }, false},
+	"jitter":         {func(cf *CloudflareIPData) float64 { return durationToMs(cf.Jitter) }, false},
+	"loss":           {func(cf *CloudflareIPData) float64 { return float64(cf.getLossRate()) }, false},
+	"connect":        {func(cf *CloudflareIPData) float64 { return durationToMs(cf.Phases.Connect) }, false},
+	"tls":            {func(cf *CloudflareIPData) float64 { return durationToMs(cf.Phases.TLS) }, false},
+	"ttfb":           {func(cf *CloudflareIPData) float64 { return durationToMs(cf.Phases.TTFB) }, false},
+	"download":       {func(cf *CloudflareIPData) float64 { return cf.DownloadSpeed / 1024 / 1024 }, true},
+	"multi_download": {func(cf *CloudflareIPData) float64 { return cf.MultiSpeed / 1024 / 1024 }, true},
+	"upload":         {func(cf *CloudflareIPData) float64 { return cf.UploadSpeed / 1024 / 1024 }, true},
+}
+
+func scoreMetricNames() string {
+	names := make([]string, 0, len(scoreMetrics))
+	for name := range scoreMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "、")
+}
+
+// 综合评分，分数越高越好，支持两种写法：
+//   - 权重：如 delay=2,jitter=1,loss=3,download=2,upload=1，各指标先在结果中归一化到 0~1（越好越接近 1），再按权重加权平均
+//   - 表达式：如 download*10 - delay - jitter*2 - loss*500，直接以指标的原始数值计算，支持 + - * / 及括号
+type Scorer struct {
+	weights map[string]float64
+	expr    scoreExpr
+}
+
+// 解析评分规则，包含 = 时为权重，否则为表达式；为空时返回 nil（即不评分）
+func ParseScorer(spec string) (*Scorer, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	if strings.Contains(spec, "=") {
+		weights, err := parseWeights(spec)
+		if err != nil {
+			return nil, err
+		}
+		return &Scorer{weights: weights}, nil
+	}
+	expr, err := parseScoreExpr(spec)
+	if err != nil {
+		return nil, fmt.Errorf("无效的评分表达式 [%s]：%v", spec, err)
+	}
+	return &Scorer{expr: expr}, nil
+}
+
+func parseWeights(spec string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	var total float64
+	for _, part := range strings.Split(spec, ",") {
+		i := strings.IndexByte(part, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("无效的评分权重 [%s]，格式应为 指标=权重", part)
+		}
+		name := strings.ToLower(strings.TrimSpace(part[:i]))
+		if _, ok := scoreMetrics[name]; !ok {
+			return nil, fmt.Errorf("不支持的评分指标 [%s]，可选 %s", name, scoreMetricNames())
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(part[i+1:]), 64)
+		if err != nil || weight < 0 || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("无效的评分权重 [%s]，权重应为非负数", part)
+		}
+		weights[name] = weight
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("评分权重 [%s] 不能全为 0", spec)
+	}
+	return weights, nil
+}
+
+// 为每个 IP 计算综合评分，并按评分从高到低排序（相同时保持原有顺序）
+func (sc *Scorer) Sort(s DownloadSpeedSet) {
+	if sc == nil || len(s) == 0 {
+		return
+	}
+	if sc.weights != nil {
+		sc.scoreWeights(s)
+	} else {
+		for i := range s {
+			s[i].Score = sc.expr.eval(&s[i])
+		}
+	}
+	for i := range s {
+		if math.IsNaN(s[i].Score) { // 如除以 0，视为最差
+			s[i].Score = math.Inf(-1)
+		}
+		s[i].scored = true
+	}
+	sort.SliceStable(s, func(i, j int) bool { return s[i].Score > s[j].Score })
+}
+
+func (sc *Scorer) scoreWeights(s DownloadSpeedSet) {
+	var total float64
+	for _, w := range sc.weights {
+		total += w
+	}
+	for i := range s {
+		s[i].Score = 0
+	}
+	for name, weight := range sc.weights {
+		metric := scoreMetrics[name]
+		low, high := math.Inf(1), math.Inf(-1)
+		for i := range s {
+			v := metric.value(&s[i])
+			low, high = math.Min(low, v), math.Max(high, v)
+		}
+		for i := range s {
+			norm := 1.0 // 所有 IP 该指标相同时不影响排序
+			if high > low {
+				norm = (metric.value(&s[i]) - low) / (high - low)
+				if !metric.higherBetter {
+					norm = 1 - norm
+				}
+			}
+			s[i].Score += norm * weight / total
+		}
+	}
+}
+
+// 评分表达式的语法树节点
+type scoreExpr interface {
+	eval(cf *CloudflareIPData) float64
+}
+
+type numberExpr float64
+
+func (n numberExpr) eval(*CloudflareIPData) float64 { return float64(n) }
+
+type metricExpr string
+
+func (m metricExpr) eval(cf *CloudflareIPData) float64 { return scoreMetrics[string(m)].value(cf) }
+
+type negExpr struct{ x scoreExpr }
+
+func (n negExpr) eval(cf *CloudflareIPData) float64 { return -n.x.eval(cf) }
+
+type binaryExpr struct {
+	op   byte
+	x, y scoreExpr
+}
+
+func (b binaryExpr) eval(cf *CloudflareIPData) float64 {
+	x, y := b.x.eval(cf), b.y.eval(cf)
+	switch b.op {
+	case '+':
+		return x + y
+	case '-':
+		return x - y
+	case '*':
+		return x * y
+	}
+	if y == 0 { // 不论被除数是否为 0，均视为最差（见 Sort），而不是正负无穷大
+		return math.NaN()
+	}
+	return x / y
+}
+
+// 递归下降解析：expr = term {(+|-) term}；term = unary {(*|/) unary}；unary = [-] primary；primary = 数字 | 指标 | (expr)
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func parseScoreExpr(s string) (scoreExpr, error) {
+	p := &exprParser{s: s}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, fmt.Errorf("第 %d 个字符 [%c] 无法解析", p.pos+1, p.s[p.pos])
+	}
+	return expr, nil
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// 跳过空格后，下一个字符为 ops 之一时读取并返回
+func (p *exprParser) accept(ops string) (byte, bool) {
+	p.skipSpace()
+	if p.pos < len(p.s) && strings.IndexByte(ops, p.s[p.pos]) >= 0 {
+		p.pos++
+		return p.s[p.pos-1], true
+	}
+	return 0, false
+}
+
+func (p *exprParser) parseExpr() (scoreExpr, error) {
+	x, err := p.parseTerm()
+	for err == nil {
+		op, ok := p.accept("+-")
+		if !ok {
+			break
+		}
+		var y scoreExpr
+		if y, err = p.parseTerm(); err == nil {
+			x = binaryExpr{op, x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *exprParser) parseTerm() (scoreExpr, error) {
+	x, err := p.parseUnary()
+	for err == nil {
+		op, ok := p.accept("*/")
+		if !ok {
+			break
+		}
+		var y scoreExpr
+		if y, err = p.parseUnary(); err == nil {
+			x = binaryExpr{op, x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *exprParser) parseUnary() (scoreExpr, error) {
+	if _, ok := p.accept("-"); ok {
+		x, err := p.parseUnary()
+		return negExpr{x}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (scoreExpr, error) {
+	if _, ok := p.accept("("); ok {
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, fmt.Errorf("缺少右括号")
+		}
+		return x, nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) && (isIdentChar(p.s[p.pos]) || p.s[p.pos] == '.') {
+		p.pos++
+	}
+	token := strings.ToLower(p.s[start:p.pos])
+	if token == "" {
+		if p.pos >= len(p.s) {
+			return nil, fmt.Errorf("表达式不完整")
+		}
+		return nil, fmt.Errorf("第 %d 个字符 [%c] 无法解析", p.pos+1, p.s[p.pos])
+	}
+	if c := token[0]; c >= '0' && c <= '9' || c == '.' {
+		v, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的数字 [%s]", token)
+		}
+		return numberExpr(v), nil
+	}
+	if _, ok := scoreMetrics[token]; !ok {
+		return nil, fmt.Errorf("不支持的评分指标 [%s]，可选 %s", token, scoreMetricNames())
+	}
+	return metricExpr(token), nil
+}
+
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测速结果中的一个 IP，速度单位 MB/s
+func testScoreIP(ip string, delay time.Duration, received int, download float64) CloudflareIPData {
+	return CloudflareIPData{
+		PingData:      &PingData{IP: &net.IPAddr{IP: net.ParseIP(ip)}, Sended: 4, Received: received, Delay: delay},
+		DownloadSpeed: download * 1024 * 1024,
+	}
+}
+
+func ipOrder(s DownloadSpeedSet) string {
+	ips := make([]string, 0, len(s))
+	for _, v := range s {
+		ips = append(ips, v.IP.String())
+	}
+	return strings.Join(ips, " ")
+}
+
+func TestParseScorerErrors(t *testing.T) {
+	tests := []struct{ spec, err string }{
+		{"delay=", "无效的评分权重 [delay=]"},
+		{"delay=-1", "无效的评分权重 [delay=-1]"},
+		{"delay=1,speed=2", "不支持的评分指标 [speed]"},
+		{"delay=0,jitter=0", "不能全为 0"},
+		{"delay=1,jitter", "格式应为 指标=权重"},
+		{"download * speed", "不支持的评分指标 [speed]"},
+		{"download *", "表达式不完整"},
+		{"(download - delay", "缺少右括号"},
+		{"download - delay)", "第 17 个字符 [)] 无法解析"},
+		{"download % 2", "第 10 个字符 [%] 无法解析"},
+		{"1..2 * download", "无效的数字 [1..2]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			sc, err := ParseScorer(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("错误 = %v，应包含 %q", err, tt.err)
+			}
+			if sc != nil {
+				t.Error("规则有误时不应返回评分器")
+			}
+		})
+	}
+	if sc, err := ParseScorer("  "); sc != nil || err != nil {
+		t.Errorf("规则为空时应不评分：%v %v", sc, err)
+	}
+}
+
+// 表达式以指标的原始数值计算：download 为 2 MB/s、delay 为 50 ms、loss 为 0.25
+func TestScoreExpr(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"download*10 - delay", -30},
+		{"DOWNLOAD * 10 - Delay", -30},
+		{"loss * 100", 25},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"8 / 4 / 2", 1},
+		{"2 * 3 / 4 + 1", 2.5},
+		{"-2 * -3", 6},
+		{"-(download + 1) * 2", -6},
+		{"0.5 * delay", 25},
+		{"download / (delay - 50)", math.Inf(-1)}, // 除以 0 视为最差
+		{"0 / jitter", math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			sc, err := ParseScorer(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := DownloadSpeedSet{testScoreIP("1.1.1.1", 50*time.Millisecond, 3, 2)}
+			sc.Sort(s)
+			if got := s[0].Score; got != tt.want && !(math.Abs(got-tt.want) < 1e-9) {
+				t.Errorf("评分 = %v，应为 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 各指标归一化到 0~1（越好越接近 1）后按权重加权平均
+func TestScoreWeights(t *testing.T) {
+	tests := []struct {
+		spec  string
+		order string
+		want  map[string]float64
+	}{
+		{"delay=1,download=1", "2.2.2.2 1.1.1.1 3.3.3.3",
+			map[string]float64{"1.1.1.1": 0.5, "2.2.2.2": 0.75, "3.3.3.3": 0.25}},
+		{"delay=3,download=1", "1.1.1.1 2.2.2.2 3.3.3.3",
+			map[string]float64{"1.1.1.1": 0.75, "2.2.2.2": 0.625, "3.3.3.3": 0.125}},
+		// 所有 IP 的丢包率相同，不影响排序
+		{"loss=1,download=1", "2.2.2.2 3.3.3.3 1.1.1.1",
+			map[string]float64{"1.1.1.1": 0.5, "2.2.2.2": 1, "3.3.3.3": 0.75}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			sc, err := ParseScorer(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := DownloadSpeedSet{
+				testScoreIP("1.1.1.1", 100*time.Millisecond, 4, 10),
+				testScoreIP("2.2.2.2", 200*time.Millisecond, 4, 30),
+				testScoreIP("3.3.3.3", 300*time.Millisecond, 4, 20),
+			}
+			sc.Sort(s)
+			if got := ipOrder(s); got != tt.order {
+				t.Errorf("顺序 = %s，应为 %s", got, tt.order)
+			}
+			for _, v := range s {
+				if want := tt.want[v.IP.String()]; math.Abs(v.Score-want) > 1e-9 {
+					t.Errorf("[%s] 的评分 = %v，应为 %v", v.IP, v.Score, want)
+				}
+			}
+		})
+	}
+}
+
+// 评分相同时保持原有顺序，评分为无效值（除以 0）的排在最后
+func TestScorerSortStable(t *testing.T) {
+	sc, err := ParseScorer("download / loss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := DownloadSpeedSet{
+		testScoreIP("1.1.1.1", 0, 4, 10), // 无丢包，除以 0
+		testScoreIP("2.2.2.2", 0, 3, 1),
+		testScoreIP("3.3.3.3", 0, 3, 2),
+		testScoreIP("4.4.4.4", 0, 2, 2), // 与 2.2.2.2 相同
+		testScoreIP("5.5.5.5", 0, 3, 1), // 与 2.2.2.2 相同
+	}
+	for i := 0; i < 2; i++ { // 再次排序时顺序不变
+		sc.Sort(s)
+		if got, want := ipOrder(s), "3.3.3.3 2.2.2.2 4.4.4.4 5.5.5.5 1.1.1.1"; got != want {
+			t.Fatalf("第 %d 次排序的顺序 = %s，应为 %s", i+1, got, want)
+		}
+	}
+	if !math.IsInf(s[4].Score, -1) || s[4].ToRecord().Score != nil {
+		t.Errorf("除以 0 的评分 = %v，应视为最差且不写入结果文件", s[4].Score)
+	}
+
+	s = DownloadSpeedSet{testScoreIP("2.2.2.2", 0, 4, 1), testScoreIP("1.1.1.1", 0, 4, 2)}
+	(*Scorer)(nil).Sort(s)
+	if got := ipOrder(s); got != "2.2.2.2 1.1.1.1" || s[0].ToRecord().Score != nil {
+		t.Errorf("不评分时不应改变顺序：%s", got)
+	}
+}
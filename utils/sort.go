@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 延迟测速结果的排序依据
+const (
+	SortDelay   = "delay"   // 平均延迟（默认）
+	SortConnect = "connect" // 平均连接耗时
+	SortTLS     = "tls"     // 平均 TLS 握手耗时
+	SortTTFB    = "ttfb"    // 平均首字节耗时
+)
+
+var delaySortKeys = map[string]func(*PingData) time.Duration{
+	SortDelay:   func(p *PingData) time.Duration { return p.Delay },
+	SortConnect: func(p *PingData) time.Duration { return p.Phases.Connect },
+	SortTLS:     func(p *PingData) time.Duration { return p.Phases.TLS },
+	SortTTFB:    func(p *PingData) time.Duration { return p.Phases.TTFB },
+}
+
+var delaySortNames = map[string]string{
+	SortDelay:   "平均延迟",
+	SortConnect: "平均连接耗时",
+	SortTLS:     "平均 TLS 握手耗时",
+	SortTTFB:    "平均首字节耗时",
+}
+
+// 排序依据的名称及对应的耗时，为空或无效时为平均延迟
+func DelaySortValue(key string, p *PingData) (string, time.Duration) {
+	value, ok := delaySortKeys[key]
+	if !ok {
+		key, value = SortDelay, delaySortKeys[SortDelay]
+	}
+	return delaySortNames[key], value(p)
+}
+
+// 检查排序依据是否有效，为空时即默认的平均延迟
+func CheckSortKey(key string) error {
+	if _, ok := delaySortKeys[key]; key != "" && !ok {
+		return fmt.Errorf("不支持的排序依据 [%s]，可选 delay、connect、tls、ttfb", key)
+	}
+	return nil
+}
+
+// 按丢包率及指定的耗时排序，相同时保持原有顺序（即延迟分组随机后的顺序）
+func (s PingDelaySet) SortBy(key string) {
+	value, ok := delaySortKeys[key]
+	if !ok || key == SortDelay {
+		return
+	}
+	sort.SliceStable(s, func(i, j int) bool {
+		iRate, jRate := s[i].getLossRate(), s[j].getLossRate()
+		if iRate != jRate {
+			return iRate < jRate
+		}
+		return value(s[i].PingData) < value(s[j].PingData)
+	})
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// 单次延迟测速各阶段的耗时
+type DelayPhases struct {
+	Connect time.Duration // TCP 连接
+	TLS     time.Duration // TLS 握手
+	TTFB    time.Duration // 首字节（发送请求后到收到响应首字节），仅 HTTPing 模式
+}
+
+// 根据每次成功的延迟测速各阶段的耗时计算平均值
+func (p *PingData) SetPhases(phases []DelayPhases) {
+	if len(phases) == 0 {
+		return
+	}
+	var total DelayPhases
+	for _, v := range phases {
+		total.Connect += v.Connect
+		total.TLS += v.TLS
+		total.TTFB += v.TTFB
+	}
+	n := time.Duration(len(phases))
+	p.Phases = DelayPhases{Connect: total.Connect / n, TLS: total.TLS / n, TTFB: total.TTFB / n}
+}
+
+// 根据每次延迟测速的结果计算 已接收、平均延迟 及延迟分布（最小/最大/中位数/P95/抖动）
+func (p *PingData) SetDelays(delays []time.Duration) {
+	p.Received = len(delays)
+	if p.Received == 0 {
+		return
+	}
+
+	var total, jitter time.Duration
+	for i, d := range delays {
+		total += d
+		if i > 0 { // 抖动 = 相邻两次延迟差值绝对值的平均值
+			diff := d - delays[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			jitter += diff
+		}
+	}
+	p.Delay = total / time.Duration(p.Received)
+	if p.Received > 1 {
+		p.Jitter = jitter / time.Duration(p.Received-1)
+	}
+
+	// 复制一份再排序，避免打乱原始的测速顺序
+	sorted := make([]time.Duration, p.Received)
+	copy(sorted, delays)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	p.MinDelay = sorted[0]
+	p.MaxDelay = sorted[len(sorted)-1]
+	if n := len(sorted); n%2 == 0 {
+		p.MedianDelay = (sorted[n/2-1] + sorted[n/2]) / 2
+	} else {
+		p.MedianDelay = sorted[n/2]
+	}
+	p.P95Delay = percentile(sorted, 0.95)
+}
+
+// 最近秩法计算百分位数，sorted 需为升序
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1 // 向上取整后转为下标
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func ms(values ...float64) []time.Duration {
+	delays := make([]time.Duration, 0, len(values))
+	for _, v := range values {
+		delays = append(delays, time.Duration(v*float64(time.Millisecond)))
+	}
+	return delays
+}
+
+func TestSetDelays(t *testing.T) {
+	tests := []struct {
+		name                               string
+		delays                             []time.Duration
+		avg, min, max, median, p95, jitter float64 // ms
+	}{
+		{"全部丢包", nil, 0, 0, 0, 0, 0, 0},
+		{"1 次", ms(50), 50, 50, 50, 50, 50, 0},
+		{"2 次", ms(60, 40), 50, 40, 60, 50, 60, 20},
+		{"奇数次", ms(30, 10, 50, 20, 40), 30, 10, 50, 30, 50, 27.5},
+		{"相同", ms(20, 20, 20, 20), 20, 20, 20, 20, 20, 0},
+		// 最近秩法：第 ceil(0.95*20) = 19 个
+		{"20 次", ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20), 10.5, 1, 20, 10.5, 19, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := append([]time.Duration(nil), tt.delays...)
+			p := &PingData{Sended: 4}
+			p.SetDelays(tt.delays)
+			if p.Received != len(tt.delays) {
+				t.Errorf("已接收 = %d，应为 %d", p.Received, len(tt.delays))
+			}
+			for _, f := range []struct {
+				name string
+				got  time.Duration
+				want float64
+			}{
+				{"平均延迟", p.Delay, tt.avg},
+				{"最小延迟", p.MinDelay, tt.min},
+				{"最大延迟", p.MaxDelay, tt.max},
+				{"中位延迟", p.MedianDelay, tt.median},
+				{"P95 延迟", p.P95Delay, tt.p95},
+				{"抖动", p.Jitter, tt.jitter},
+			} {
+				if got := durationToMs(f.got); got != f.want {
+					t.Errorf("%s = %v ms，应为 %v ms", f.name, got, f.want)
+				}
+			}
+			for i := range original {
+				if tt.delays[i] != original[i] {
+					t.Fatalf("不应改变原始的测速顺序：%v", tt.delays)
+				}
+			}
+		})
+	}
+}
+
+func TestSetPhases(t *testing.T) {
+	p := &PingData{}
+	p.SetPhases(nil)
+	if p.Phases != (DelayPhases{}) {
+		t.Errorf("没有成功的测速时不应记录各阶段耗时：%+v", p.Phases)
+	}
+	p.SetPhases([]DelayPhases{
+		{Connect: 10 * time.Millisecond, TLS: 20 * time.Millisecond},
+		{Connect: 30 * time.Millisecond, TLS: 40 * time.Millisecond, TTFB: 60 * time.Millisecond},
+	})
+	if want := (DelayPhases{Connect: 20 * time.Millisecond, TLS: 30 * time.Millisecond, TTFB: 30 * time.Millisecond}); p.Phases != want {
+		t.Errorf("各阶段平均耗时 = %+v，应为 %+v", p.Phases, want)
+	}
+}
@@ -0,0 +1,20 @@
+package utils
+
+// 通过 /cdn-cgi/trace 获取的 IP 信息，未获取时均为空
+type TraceInfo struct {
+	Colo        string // 实际提供服务的数据中心
+	ClientIP    string // Cloudflare 看到的客户端 IP，与本机出口 IP 不同时可能经过了透明代理
+	HTTPVersion string // 如 http/1.1
+	TLSVersion  string // 如 TLSv1.3，HTTP 访问时为 off
+	Warp        string // WARP 状态，如 off
+}
+
+// 是否有 IP 获取到了 trace 信息，有则在结果文件中追加对应的列
+func hasTrace(data []CloudflareIPData) bool {
+	for _, v := range data {
+		if v.Trace != (TraceInfo{}) {
+			return true
+		}
+	}
+	return false
+}